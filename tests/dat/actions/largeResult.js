@@ -0,0 +1,9 @@
+function main(args) {
+    // a result of args.count properties, each a 100 character string
+    var value = new Array(101).join('x');
+    var result = {};
+    for (var i = 0; i < args.count; i++) {
+        result['key' + i] = value;
+    }
+    return result;
+}
@@ -201,13 +201,19 @@ class WskAction()
         memory: Option[Int] = None,
         shared: Option[Boolean] = None,
         update: Boolean = false,
+        execOnly: Boolean = false,
+        annotationFile: Option[String] = None,
+        upsert: Boolean = false,
         expectedExitCode: Int = SUCCESS_EXIT)(
             implicit wp: WskProps): RunResult = {
         val params = Seq(noun, if (!update) "create" else "update", "--auth", wp.authKey, fqn(name)) ++
             { artifact map { Seq(_) } getOrElse Seq() } ++
+            { if (upsert) Seq("--upsert") else Seq() } ++
             { kind map { k => Seq(s"--$k") } getOrElse Seq() } ++
+            { if (execOnly) Seq("--exec-only") else Seq() } ++
+            { annotationFile map { f => Seq("--annotation-file", f) } getOrElse Seq() } ++
             { parameters flatMap { p => Seq("-p", p._1, p._2.compactPrint) } } ++
-            { annotations flatMap { p => Seq("-p", p._1, p._2.compactPrint) } } ++
+            { annotations flatMap { p => Seq("-a", p._1, p._2.compactPrint) } } ++
             { timeout map { t => Seq("-t", t.toMillis.toString) } getOrElse Seq() } ++
             { memory map { m => Seq("-m", m.toString) } getOrElse Seq() } ++
             { shared map { s => Seq("--shared", if (s) "yes" else "no") } getOrElse Seq() }
@@ -278,7 +284,7 @@ class WskTrigger()
         val params = Seq(noun, if (!update) "create" else "update", "--auth", wp.authKey, fqn(name)) ++
             { feed map { f => Seq("--feed", fqn(f)) } getOrElse Seq() } ++
             { parameters flatMap { p => Seq("-p", p._1, p._2.compactPrint) } } ++
-            { annotations flatMap { p => Seq("-p", p._1, p._2.compactPrint) } } ++
+            { annotations flatMap { p => Seq("-a", p._1, p._2.compactPrint) } } ++
             { shared map { s => Seq("--shared", if (s) "yes" else "no") } getOrElse Seq() }
         cli(wp.overrides ++ params, expectedExitCode)
     }
@@ -329,7 +335,7 @@ class WskRule()
         expectedExitCode: Int = SUCCESS_EXIT)(
             implicit wp: WskProps): RunResult = {
         val params = Seq(noun, if (!update) "create" else "update", "--auth", wp.authKey, fqn(name), (trigger), (action)) ++
-            { annotations flatMap { p => Seq("-p", p._1, p._2.compactPrint) } } ++
+            { annotations flatMap { p => Seq("-a", p._1, p._2.compactPrint) } } ++
             { if (enable) Seq("--enable") else Seq() } ++
             { shared map { s => Seq("--shared", if (s) "yes" else "no") } getOrElse Seq() }
         val result = cli(wp.overrides ++ params, expectedExitCode)
@@ -625,7 +631,7 @@ class WskPackage()
             implicit wp: WskProps): RunResult = {
         val params = Seq(noun, if (!update) "create" else "update", "--auth", wp.authKey, fqn(name)) ++
             { parameters flatMap { p => Seq("-p", p._1, p._2.compactPrint) } } ++
-            { annotations flatMap { p => Seq("-p", p._1, p._2.compactPrint) } } ++
+            { annotations flatMap { p => Seq("-a", p._1, p._2.compactPrint) } } ++
             { shared map { s => Seq("--shared", if (s) "yes" else "no") } getOrElse Seq() }
         cli(wp.overrides ++ params, expectedExitCode)
     }
@@ -647,6 +653,20 @@ class WskPackage()
             { parameters flatMap { p => Seq("-p", p._1, p._2.compactPrint) } }
         cli(wp.overrides ++ params, expectedExitCode)
     }
+
+    /**
+     * Deletes package binding. Fails if the package is not a binding.
+     *
+     * @param name either a fully qualified name or a simple entity name
+     * @param expectedExitCode (optional) the expected exit code for the command
+     * if the code is anything but DONTCARE_EXIT, assert the code is as expected
+     */
+    def unbind(
+        name: String,
+        expectedExitCode: Int = SUCCESS_EXIT)(
+            implicit wp: WskProps): RunResult = {
+        cli(wp.overrides ++ Seq(noun, "unbind", "--auth", wp.authKey, fqn(name)), expectedExitCode)
+    }
 }
 
 trait WaitFor {
@@ -17,7 +17,16 @@
 package system.basic
 
 import java.io.File
+import java.net.InetAddress
+import java.net.ServerSocket
+import java.net.Socket
+import java.nio.file.Files
+import java.util.concurrent.atomic.AtomicInteger
+import java.util.concurrent.atomic.AtomicLong
+import java.nio.file.attribute.PosixFilePermissions
+import scala.collection.JavaConversions.mapAsJavaMap
 import scala.collection.mutable.ListBuffer
+import scala.util.Try
 import org.apache.commons.io.FileUtils
 import org.junit.runner.RunWith
 import org.scalatest.BeforeAndAfterAll
@@ -32,6 +41,7 @@ import common.RunWskAdminCmd
 import common.RunWskCmd
 import common.TestUtils
 import common.TestUtils._
+import common.WhiskProperties
 import common.Wsk
 import common.WskAction
 import common.WskProps
@@ -52,6 +62,79 @@ class WskBasicTests
     val wsk = new Wsk()
     val defaultAction = Some(TestUtils.getCatalogFilename("samples/hello.js"))
 
+    /**
+     * Runs wsk with a pseudo terminal as its stdin and stdout, as when a user
+     * runs it, and types the input; the input is written before the CLI reads
+     * any, and the terminal hands it over a line at a time.
+     */
+    def cliWithTerminal(params: Seq[String], input: String, env: Map[String, String]) = {
+        val driver = """
+            |import os, pty, sys
+            |pid, fd = pty.fork()
+            |if pid == 0:
+            |    os.execvp(sys.argv[2], sys.argv[2:])
+            |os.write(fd, sys.argv[1])
+            |while True:
+            |    try:
+            |        data = os.read(fd, 1024)
+            |    except OSError:
+            |        break
+            |    if not data:
+            |        break
+            |    sys.stdout.write(data)
+            |sys.exit(os.waitpid(pid, 0)[1] >> 8)
+            |""".stripMargin
+        val command = Seq(WhiskProperties.python, "-c", driver, input) ++ Wsk.baseCommand ++ params
+        TestUtils.runCmd(DONTCARE_EXIT, new File("."), TestUtils.logger, env, command: _*)
+    }
+
+    /**
+     * Starts a proxy to the API host on a local port which closes a connection
+     * once it has been idle for idleMillis, as a load balancer with an idle
+     * timeout does. Returns the proxy socket and the count of connections it
+     * accepted; closing the socket stops the proxy.
+     */
+    def idleClosingProxy(apihost: String, idleMillis: Long) = {
+        val Array(host, port) = (if (apihost.contains(":")) apihost else s"$apihost:443").split(":")
+        val proxy = new ServerSocket(0, 50, InetAddress.getLoopbackAddress)
+        val accepted = new AtomicInteger(0)
+        def background(body: => Unit) = {
+            val thread = new Thread(new Runnable { def run() = body })
+            thread.setDaemon(true)
+            thread.start()
+        }
+        background {
+            Try {
+                while (true) {
+                    val client = proxy.accept()
+                    val upstream = new Socket(host, port.toInt)
+                    val lastActive = new AtomicLong(System.currentTimeMillis)
+                    def close() = { client.close(); upstream.close() }
+                    def forward(from: Socket, to: Socket) = background {
+                        val buffer = new Array[Byte](8192)
+                        Try {
+                            Iterator.continually(from.getInputStream.read(buffer)).takeWhile(_ >= 0).foreach { n =>
+                                lastActive.set(System.currentTimeMillis)
+                                to.getOutputStream.write(buffer, 0, n)
+                            }
+                        }
+                        close()
+                    }
+                    accepted.incrementAndGet()
+                    forward(client, upstream)
+                    forward(upstream, client)
+                    background {
+                        while (!client.isClosed) {
+                            Thread.sleep(100)
+                            if (System.currentTimeMillis - lastActive.get > idleMillis) close()
+                        }
+                    }
+                }
+            }
+        }
+        (proxy, accepted)
+    }
+
     behavior of "Wsk CLI"
 
     it should "confirm wsk exists" in {
@@ -69,6 +152,8 @@ class WskBasicTests
     it should "show cli build version" in {
         val stdout = wsk.cli(Seq("property", "get", "--cliversion")).stdout
         stdout should include regex ("""whisk CLI version\s+201.*\n""")
+        // the version is the one the build wrote to default.props
+        stdout should include(s"whisk CLI version\t${WhiskProperties.getProperty("whisk.version.date")}\n")
     }
 
     it should "show api version" in {
@@ -86,6 +171,76 @@ class WskBasicTests
         stdout should include regex ("""whisk API build*.*.*\n""")
     }
 
+    it should "show cli version and api build" in {
+        val stdout = wsk.cli(wskprops.overrides ++ Seq("version")).stdout
+        stdout should include regex ("""whisk CLI version\s+201.*\n""")
+        stdout should include regex ("""whisk API build\s+201.*\n""")
+        stdout should include("python version")
+    }
+
+    it should "show cli version when the api host is unreachable" in {
+        val stdout = wsk.cli(Seq("--apihost", "localhost:1", "version")).stdout
+        stdout should include regex ("""whisk CLI version\s+201.*\n""")
+        stdout should include regex ("""whisk API build\s+unavailable""")
+    }
+
+    it should "accept the api host as an https url" in {
+        Seq(s"https://${wskprops.apihost}", s"https://${wskprops.apihost}/", s"https://${wskprops.apihost}/api/v1") foreach { host =>
+            val stdout = wsk.cli(Seq("--apihost", host, "namespace", "list", "--auth", wskprops.authKey), verbose = true).stdout
+            stdout should include(s"GET https://${wskprops.apihost}/api/v1/namespaces")
+        }
+        wsk.cli(Seq("--apihost", s"http://${wskprops.apihost}", "namespace", "list", "--auth", wskprops.authKey), expectedExitCode = MISUSE_EXIT).
+            stdout should include("must be a host name or an https url")
+    }
+
+    it should "join routes to an api host and version given with slashes using single slashes" in {
+        val stdout = wsk.cli(Seq("--apihost", s"https://${wskprops.apihost}/", "--apiversion", "/v1/", "namespace", "list", "--auth", wskprops.authKey), verbose = true).stdout
+        stdout should include(s"GET https://${wskprops.apihost}/api/v1/namespaces\n")
+
+        val propsFile = File.createTempFile("wskprops", ".tmp")
+        try {
+            val env = Map("WSK_CONFIG_FILE" -> propsFile.getAbsolutePath())
+            val set = Seq("property", "set", "--auth", wskprops.authKey, "--apihost", s"https://${wskprops.apihost}/", "--apiversion", "v1/", "--namespace", "notANamespace")
+            wsk.cli(set, expectedExitCode = DONTCARE_EXIT, verbose = true, env = env).
+                stdout should include(s"GET https://${wskprops.apihost}/api/v1/namespaces/\n")
+        } finally {
+            propsFile.delete()
+        }
+    }
+
+    it should "give up on the api build when the api host does not respond" in {
+        // accepts connections but never responds
+        val server = new java.net.ServerSocket(0)
+        try {
+            val start = System.currentTimeMillis
+            val stdout = wsk.cli(Seq("--apihost", s"localhost:${server.getLocalPort}", "property", "get", "--apibuild"), expectedExitCode = ANY_ERROR_EXIT).stdout
+            (System.currentTimeMillis - start) should be < 30000L
+            stdout should include("Cannot determine API build")
+        } finally {
+            server.close()
+        }
+    }
+
+    it should "reject a response larger than the most it accepts" in {
+        wsk.cli(wskprops.overrides ++ Seq("--max-response", "10", "namespace", "list", "--auth", wskprops.authKey), expectedExitCode = ANY_ERROR_EXIT).
+            stdout should include("the response is larger than 10 bytes")
+        wsk.cli(wskprops.overrides ++ Seq("--max-response", "100000", "namespace", "list", "--auth", wskprops.authKey))
+    }
+
+    it should "print each property on its own line when the api host is not set" in {
+        val propsFile = File.createTempFile("wskprops", ".tmp")
+        try {
+            FileUtils.writeStringToFile(propsFile, "AUTH=testKey\n")
+            val env = Map("WSK_CONFIG_FILE" -> propsFile.getAbsolutePath(), "WHISK_APIHOST" -> "")
+            val stdout = wsk.cli(Seq("property", "get", "--apibuild", "--apibuildno"), env = env).stdout
+            stdout should endWith("\n")
+            stdout.lines.toList should have size 2
+            stdout.lines foreach { _ should startWith("whisk ") }
+        } finally {
+            propsFile.delete()
+        }
+    }
+
     it should "set auth in property file" in {
         val wskprops = File.createTempFile("wskprops", ".tmp")
         val env = Map("WSK_CONFIG_FILE" -> wskprops.getAbsolutePath())
@@ -95,6 +250,222 @@ class WskBasicTests
         wskprops.delete()
     }
 
+    it should "not read the property file when apihost and auth are given" in {
+        val propsFile = File.createTempFile("wskprops", ".tmp")
+        try {
+            // a list in the namespace of the file would fail if the file were read
+            FileUtils.writeStringToFile(propsFile, "this is not a property file\nAUTH\nNAMESPACE=notmynamespace\n")
+            val env = Map("WSK_CONFIG_FILE" -> propsFile.getAbsolutePath())
+            wsk.cli(wskprops.overrides ++ Seq("namespace", "list", "--auth", wskprops.authKey), env = env)
+            wsk.cli(wskprops.overrides ++ Seq("action", "list", "--auth", wskprops.authKey), env = env)
+
+            // an auth file gives the auth key on the command line too
+            val authFile = File.createTempFile("wskauth", ".tmp")
+            try {
+                FileUtils.writeStringToFile(authFile, s"${wskprops.authKey}\n")
+                wsk.cli(wskprops.overrides ++ Seq("--auth-file", authFile.getAbsolutePath(), "action", "list"), env = env)
+                wsk.cli(wskprops.overrides ++ Seq("action", "list"), env = env ++ Map("WHISK_AUTH_FILE" -> authFile.getAbsolutePath()))
+            } finally {
+                authFile.delete()
+            }
+        } finally {
+            propsFile.delete()
+        }
+    }
+
+    it should "read the property file for property get even when given --auth and --apihost flags" in {
+        val propsFile = File.createTempFile("wskprops", ".tmp")
+        try {
+            FileUtils.writeStringToFile(propsFile, "AUTH=fileKey\nAPIHOST=filehost\n")
+            val env = Map("WSK_CONFIG_FILE" -> propsFile.getAbsolutePath())
+            val stdout = wsk.cli(Seq("property", "get", "--auth", "--apihost", "--namespace"), env = env).stdout
+            stdout should include regex ("""whisk auth\s+fileKey""")
+            stdout should include regex ("""whisk API host\s+filehost""")
+        } finally {
+            propsFile.delete()
+        }
+    }
+
+    it should "show usage rather than prompt when property set is given no property without a terminal" in {
+        val propsFile = File.createTempFile("wskprops", ".tmp")
+        try {
+            val env = Map("WSK_CONFIG_FILE" -> propsFile.getAbsolutePath())
+            val stdout = wsk.cli(Seq("property", "set"), expectedExitCode = MISUSE_EXIT, env = env).stdout
+            stdout should include("no property to set was given")
+            stdout should include("usage: wsk property set")
+            FileUtils.readFileToString(propsFile) shouldBe empty
+        } finally {
+            propsFile.delete()
+        }
+    }
+
+    it should "prompt for the properties when property set is given no property on a terminal" in {
+        val propsFile = File.createTempFile("wskprops", ".tmp")
+        try {
+            val env = Map("WSK_CONFIG_FILE" -> propsFile.getAbsolutePath())
+            // an invalid answer is asked for again; the namespace is chosen from a list
+            val input = Seq("not a host", wskprops.apihost, "notakey", wskprops.authKey, "1").mkString("", "\n", "\n")
+            val rr = cliWithTerminal(Seq("property", "set"), input, env)
+            rr.exitCode shouldBe SUCCESS_EXIT
+            rr.stdout should include("error: that is not a valid whisk API host.")
+            rr.stdout should include("error: that is not a valid authorization key.")
+            rr.stdout should include("ok: namespace set to")
+            val props = FileUtils.readFileToString(propsFile)
+            props should include(s"APIHOST=${wskprops.apihost}")
+            props should include(s"AUTH=${wskprops.authKey}")
+            props should include("NAMESPACE=")
+        } finally {
+            propsFile.delete()
+        }
+    }
+
+    it should "reject a property file that is a directory" in {
+        val dir = Files.createTempDirectory("wskprops").toFile
+        val env = Map("WSK_CONFIG_FILE" -> dir.getAbsolutePath())
+        try {
+            wsk.cli(Seq("property", "set", "--auth", "testKey"), expectedExitCode = MISUSE_EXIT, env = env).
+                stdout should include("is a directory; WSK_CONFIG_FILE must name a file")
+            wsk.cli(Seq("property", "get", "--auth"), expectedExitCode = MISUSE_EXIT, env = env).
+                stdout should include("is a directory; WSK_CONFIG_FILE must name a file")
+        } finally {
+            FileUtils.deleteDirectory(dir)
+        }
+    }
+
+    it should "set and get properties in a profile" in {
+        val propsFile = File.createTempFile("wskprops", ".tmp")
+        val profileFile = new File(propsFile.getAbsolutePath() + ".prod")
+        val env = Map("WSK_CONFIG_FILE" -> propsFile.getAbsolutePath())
+        try {
+            wsk.cli(Seq("property", "set", "--auth", "defaultKey"), env = env)
+            wsk.cli(Seq("--profile", "prod", "property", "set", "--auth", "prodKey"), env = env)
+            FileUtils.readFileToString(propsFile) should include("AUTH=defaultKey")
+            FileUtils.readFileToString(profileFile) should include("AUTH=prodKey")
+
+            wsk.cli(Seq("--profile", "prod", "property", "get", "--auth"), env = env).stdout should include regex ("""whisk auth\s+prodKey""")
+            wsk.cli(Seq("property", "get", "--auth"), env = env ++ Map("WSK_PROFILE" -> "prod")).stdout should include regex ("""whisk auth\s+prodKey""")
+            wsk.cli(Seq("property", "get", "--auth"), env = env).stdout should include regex ("""whisk auth\s+defaultKey""")
+        } finally {
+            propsFile.delete()
+            profileFile.delete()
+        }
+    }
+
+    it should "list the namespaces once when setting several properties with the namespace" in {
+        val propsFile = File.createTempFile("wskprops", ".tmp")
+        val env = Map("WSK_CONFIG_FILE" -> propsFile.getAbsolutePath())
+        try {
+            val namespace = wsk.namespace.list().stdout.lines.toList(1).trim
+            val set = Seq("property", "set", "--auth", wskprops.authKey, "--apihost", wskprops.apihost, "--apiversion", "v1", "--namespace", namespace)
+            val stdout = wsk.cli(set, verbose = true, env = env).stdout
+            "GET https://[^\\s]+/namespaces".r.findAllIn(stdout).length shouldBe 1
+            stdout should include(s"ok: namespace set to $namespace")
+
+            wsk.cli(Seq("property", "set", "--auth", wskprops.authKey, "--apihost", wskprops.apihost), verbose = true, env = env).
+                stdout should not include ("/namespaces")
+        } finally {
+            propsFile.delete()
+        }
+    }
+
+    it should "print the effective configuration without secrets" in {
+        val propsFile = File.createTempFile("wskprops", ".tmp")
+        try {
+            FileUtils.writeStringToFile(propsFile, "AUTH=diaguser:diagsecret\nAPIHOST=diaghost\n")
+            val env = Map("WSK_CONFIG_FILE" -> propsFile.getAbsolutePath(), "WHISK_NAMESPACE" -> "diagns")
+            val stdout = wsk.cli(Seq("property", "diag"), env = env).stdout
+            stdout should include regex (s"""whisk property file\\s+${propsFile.getAbsolutePath()}\n""")
+            stdout should include regex ("""whisk API host\s+diaghost""")
+            stdout should include regex ("""whisk namespace\s+diagns""")
+            stdout should include regex ("""whisk auth user\s+diaguser \(key redacted\)""")
+            stdout should include regex ("""environment\s+.*WHISK_NAMESPACE""")
+            stdout should not include ("diagsecret")
+        } finally {
+            propsFile.delete()
+        }
+    }
+
+    it should "create the property file and its directories on first set" in {
+        val root = new File(FileUtils.getTempDirectory(), s"wskprops${System.currentTimeMillis}")
+        val propsFile = new File(root, "nested/wskprops")
+        val env = Map("WSK_CONFIG_FILE" -> propsFile.getAbsolutePath())
+        try {
+            val stdout = wsk.cli(Seq("property", "set", "--auth", "testKey"), env = env).stdout
+            stdout should include(s"ok: created property file ${propsFile.getAbsolutePath()}")
+            FileUtils.readFileToString(propsFile) should include("AUTH=testKey")
+            PosixFilePermissions.toString(Files.getPosixFilePermissions(propsFile.getParentFile.toPath)) shouldBe "rwx------"
+            PosixFilePermissions.toString(Files.getPosixFilePermissions(propsFile.toPath)) shouldBe "rw-------"
+            wsk.cli(Seq("property", "set", "--auth", "otherKey"), env = env).stdout should not include ("created property file")
+        } finally {
+            FileUtils.deleteDirectory(root)
+        }
+    }
+
+    it should "reject a client certificate without a key or that cannot be read" in {
+        val missingKey = wsk.cli(wskprops.overrides ++ Seq("--cert", "cert.pem", "namespace", "list"), expectedExitCode = MISUSE_EXIT).stdout
+        missingKey should include("requires both --cert and --key")
+        val unreadable = wsk.cli(wskprops.overrides ++ Seq("--cert", "nosuchcert.pem", "--key", "nosuchkey.pem", "namespace", "list"), expectedExitCode = MISUSE_EXIT).stdout
+        unreadable should include("cannot read client certificate file")
+    }
+
+    it should "set client certificate and key in property file" in {
+        val propsFile = File.createTempFile("wskprops", ".tmp")
+        val env = Map("WSK_CONFIG_FILE" -> propsFile.getAbsolutePath())
+        wsk.cli(Seq("property", "set", "--cert", "/tmp/client.pem", "--key", "/tmp/client.key"), env = env)
+        val fileContent = FileUtils.readFileToString(propsFile)
+        fileContent should include("CERT=/tmp/client.pem")
+        fileContent should include("KEY=/tmp/client.key")
+        propsFile.delete()
+    }
+
+    it should "resolve apihost and auth from flag, then environment, then property file" in {
+        val propsFile = File.createTempFile("wskprops", ".tmp")
+        try {
+            FileUtils.writeStringToFile(propsFile, "APIHOST=fileHost\nAUTH=fileKey\n")
+            val file = Map("WSK_CONFIG_FILE" -> propsFile.getAbsolutePath())
+            val env = file ++ Map("WHISK_APIHOST" -> "envHost", "WHISK_AUTH" -> "envKey")
+            val cases = Seq(
+                (file, Seq(), "fileHost", "fileKey"),
+                (env, Seq(), "envHost", "envKey"),
+                (env, Seq("--apihost", "flagHost"), "flagHost", "envKey"))
+
+            cases foreach {
+                case (e, flags, host, key) =>
+                    val stdout = wsk.cli(flags ++ Seq("property", "get", "--apihost", "--auth"), env = e).stdout
+                    stdout should include regex (s"whisk API host\\s+$host\n")
+                    stdout should include regex (s"whisk auth\\s+$key\n")
+            }
+
+            // an explicit auth key wins over an invalid key in the environment
+            wsk.cli(wskprops.overrides ++ Seq("namespace", "list", "--auth", WskProps().authKey), env = env)
+        } finally {
+            propsFile.delete()
+        }
+    }
+
+    it should "read the auth key from an auth file" in {
+        val authFile = File.createTempFile("wskauth", ".tmp")
+        try {
+            FileUtils.writeStringToFile(authFile, s"${wskprops.authKey}  \n")
+            val props = File.createTempFile("wskprops", ".tmp")
+            try {
+                FileUtils.writeStringToFile(props, s"APIHOST=${wskprops.apihost}\n")
+                val env = Map("WSK_CONFIG_FILE" -> props.getAbsolutePath())
+                wsk.cli(Seq("--auth-file", authFile.getAbsolutePath(), "namespace", "list"), env = env)
+                wsk.cli(Seq("namespace", "list"), env = env ++ Map("WHISK_AUTH_FILE" -> authFile.getAbsolutePath()))
+            } finally {
+                props.delete()
+            }
+        } finally {
+            authFile.delete()
+        }
+    }
+
+    it should "reject an auth file that is missing" in {
+        val stdout = wsk.cli(wskprops.overrides ++ Seq("--auth-file", "nosuchauthfile", "namespace", "list"), expectedExitCode = MISUSE_EXIT).stdout
+        stdout should include("cannot read an authorization key from nosuchauthfile")
+    }
+
     it should "reject creating duplicate entity" in withAssetCleaner(wskprops) {
         (wp, assetHelper) =>
             val name = "testDuplicateCreate"
@@ -106,6 +477,95 @@ class WskBasicTests
             }
     }
 
+    it should "reject an action in another namespace with strict namespace" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val ns = wsk.namespace.list().stdout.lines.toList(1).trim
+            val env = Map("WHISK_NAMESPACE" -> ns)
+            val name = "strictNamespace"
+            def create(qname: String, expectedExitCode: Int) = wsk.cli(wp.overrides ++
+                Seq("action", "create", "--auth", wp.authKey, qname, defaultAction.get, "--strict-namespace"),
+                expectedExitCode, env = env)
+
+            create(s"/notmy$ns/$name", MISUSE_EXIT).stdout should include("omit --strict-namespace to confirm")
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => create(s"/$ns/$name", SUCCESS_EXIT)
+            }
+    }
+
+    it should "prefer the namespace in a name to the namespace flag and the flag to the properties" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val ns = wsk.namespace.list().stdout.lines.toList(1).trim
+            val env = Map("WHISK_NAMESPACE" -> s"notmy$ns")
+            val name = "namespaceFlag"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, defaultAction)
+            }
+            def get(flag: Seq[String], qname: String, expectedExitCode: Int = SUCCESS_EXIT) = wsk.cli(wp.overrides ++ flag ++
+                Seq("action", "get", "--auth", wp.authKey, qname), expectedExitCode, verbose = true, env = env)
+
+            get(Seq(), name, ANY_ERROR_EXIT).stdout should include(s"/namespaces/notmy$ns/actions/$name")
+            get(Seq("-n", ns), name).stdout should include(s"/namespaces/$ns/actions/$name")
+            get(Seq("--namespace", s"notmy$ns"), s"/$ns/$name").stdout should include(s"/namespaces/$ns/actions/$name")
+    }
+
+    it should "update an action only if it exists with must exist" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "mustExistAction"
+            val missingName = "mustExistMissingAction"
+            def update(name: String, expectedExitCode: Int) = wsk.cli(wp.overrides ++
+                Seq("action", "update", "--auth", wp.authKey, name, defaultAction.get, "--must-exist"), expectedExitCode)
+
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, defaultAction)
+            }
+            update(name, SUCCESS_EXIT)
+            update(missingName, NOT_FOUND).stdout should include("does not exist")
+            wsk.action.get(missingName, expectedExitCode = NOT_FOUND)
+
+            // without the flag, update still creates the action
+            assetHelper.withCleaner(wsk.action, missingName) {
+                (action, _) => action.create(missingName, defaultAction, update = true)
+            }
+    }
+
+    it should "replace an existing action on create with upsert" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "testUpsertCreate"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, defaultAction, upsert = true)
+            }
+            wsk.action.create(name, defaultAction, upsert = true)
+            wsk.action.create(name, defaultAction, expectedExitCode = CONFLICT).
+                stdout should include(s"""error: action $name already exists; change it with "wsk action update" or give --upsert to replace it""")
+    }
+
+    it should "explain how to change a trigger or package that already exists on create" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val triggerName = "testConflictTrigger"
+            val packageName = "testConflictPackage"
+            assetHelper.withCleaner(wsk.trigger, triggerName) {
+                (trigger, name) => trigger.create(name)
+            }
+            assetHelper.withCleaner(wsk.pkg, packageName) {
+                (pkg, name) => pkg.create(name)
+            }
+            wsk.trigger.create(triggerName, expectedExitCode = CONFLICT).
+                stdout should include(s"""error: trigger $triggerName already exists; change it with "wsk trigger update""")
+            wsk.pkg.create(packageName, expectedExitCode = CONFLICT).
+                stdout should include(s"""error: package $packageName already exists; change it with "wsk package update""")
+    }
+
+    it should "reject a library that is not a readable tar archive" in {
+        val lib = File.createTempFile("wsklib", ".tgz")
+        try {
+            FileUtils.writeStringToFile(lib, "this is not an archive")
+            val stdout = wsk.cli(wskprops.overrides ++ Seq("action", "create", "--auth", wskprops.authKey, "rejectLibAction", defaultAction.get, "--lib", lib.getAbsolutePath()), expectedExitCode = MISUSE_EXIT).stdout
+            stdout should include("is not a readable gzipped tar archive")
+        } finally {
+            lib.delete()
+        }
+    }
+
     it should "reject deleting entity in wrong collection" in withAssetCleaner(wskprops) {
         (wp, assetHelper) =>
             val name = "testCrossDelete"
@@ -117,18 +577,24 @@ class WskBasicTests
 
     it should "reject creating entities with invalid names" in withAssetCleaner(wskprops) {
         (wp, assetHelper) =>
-            val names = Seq(
-                ("", NOTALLOWED),
-                (" ", BAD_REQUEST),
-                ("hi+there", BAD_REQUEST),
-                ("$hola", BAD_REQUEST),
-                ("dora?", BAD_REQUEST),
-                ("|dora|dora?", BAD_REQUEST))
+            val names = Seq("", " ", "trailing ", "hi+there", "$hola", "dora?", "|dora|dora?", "pkg/$hola")
 
             names foreach {
-                case (name, ec) =>
+                name =>
                     assetHelper.withCleaner(wsk.action, name, confirmDelete = false) {
-                        (action, _) => action.create(name, defaultAction, expectedExitCode = ec)
+                        (action, _) => action.create(name, defaultAction, expectedExitCode = MISUSE_EXIT)
+                    }.stdout should include("is not valid")
+            }
+    }
+
+    it should "create entities with names using all allowed characters" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val names = Seq("_", "a", "hello world", "foo@bar.com", "a-b_c.d")
+
+            names foreach {
+                name =>
+                    assetHelper.withCleaner(wsk.trigger, name) {
+                        (trigger, _) => trigger.create(name)
                     }
             }
     }
@@ -136,15 +602,26 @@ class WskBasicTests
     it should "reject unauthenticated access" in {
         implicit val wskprops = WskProps("xxx") // shadow properties
         val errormsg = "The supplied authentication is invalid"
-        wsk.namespace.list(expectedExitCode = UNAUTHORIZED).
-            stdout should include(errormsg)
+        val stdout = wsk.namespace.list(expectedExitCode = UNAUTHORIZED).stdout
+        stdout should include(errormsg)
+        stdout should include("authentication failed; check the authorization key")
         wsk.namespace.get(expectedExitCode = UNAUTHORIZED).
             stdout should include(errormsg)
     }
 
+    it should "check that the api host is reachable and accepts the auth key" in {
+        wsk.cli(wskprops.overrides ++ Seq("property", "check", "--auth", wskprops.authKey)).
+            stdout should include("is reachable and accepts the authorization key")
+        wsk.cli(wskprops.overrides ++ Seq("property", "check", "--auth", "xxx"), expectedExitCode = UNAUTHORIZED).
+            stdout should include("authorization error")
+        wsk.cli(Seq("--apihost", "localhost:1", "property", "check", "--auth", wskprops.authKey), expectedExitCode = TIMEOUT).
+            stdout should include("network error")
+    }
+
     it should "reject deleting action in shared package not owned by authkey" in {
         wsk.action.get("/whisk.system/util/cat") // make sure it exists
-        wsk.action.delete("/whisk.system/util/cat", expectedExitCode = FORBIDDEN)
+        wsk.action.delete("/whisk.system/util/cat", expectedExitCode = FORBIDDEN).
+            stdout should include("not authorized; check that the authorization key is entitled to the namespace")
     }
 
     it should "reject create action in shared package not owned by authkey" in {
@@ -190,6 +667,32 @@ class WskBasicTests
         result should include regex ("""/whisk.system/util/date\s+shared""")
     }
 
+    it should "resolve the parameters of an action in a package binding" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val pkgName = "resolvePackage"
+            val bindName = "resolveBinding"
+            val actionName = s"$pkgName/resolveAction"
+            assetHelper.withCleaner(wsk.pkg, pkgName) {
+                (pkg, _) => pkg.create(pkgName, parameters = Map("a" -> "A".toJson, "b" -> "B".toJson))
+            }
+            assetHelper.withCleaner(wsk.action, actionName) {
+                (action, _) => action.create(actionName, defaultAction, parameters = Map("b" -> "X".toJson))
+            }
+            assetHelper.withCleaner(wsk.pkg, bindName) {
+                (pkg, _) => pkg.bind(pkgName, bindName, parameters = Map("a" -> "Z".toJson))
+            }
+
+            val stdout = wsk.cli(wp.overrides ++ Seq("action", "get", "--auth", wp.authKey, s"$bindName/resolveAction", "--resolve")).stdout
+            val resolved = stdout.substring(stdout.indexOf('{')).parseJson.asJsObject
+            def params(field: String) = resolved.fields(field) match {
+                case JsArray(ps) => ps.map { p => p.asJsObject.fields("key") -> p.asJsObject.fields("value") }.toMap
+                case _           => Map()
+            }
+            params("packageParameters") shouldBe Map("a".toJson -> "A".toJson, "b".toJson -> "B".toJson)
+            params("bindingParameters") shouldBe Map("a".toJson -> "Z".toJson)
+            params("parameters") shouldBe Map("a".toJson -> "Z".toJson, "b".toJson -> "X".toJson)
+    }
+
     it should "create, update, get and list a package" in withAssetCleaner(wskprops) {
         (wp, assetHelper) =>
             val name = "samplePackage"
@@ -207,6 +710,101 @@ class WskBasicTests
             wsk.pkg.list().stdout should include(name)
     }
 
+    it should "create a package with parameters and annotations from files" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "paramFilePackage"
+            val paramFile = File.createTempFile("parameters", ".json")
+            val annotationFile = File.createTempFile("annotations", ".json")
+            FileUtils.writeStringToFile(paramFile, """{ "a": 1, "b": { "x": true }, "c": "file" }""")
+            FileUtils.writeStringToFile(annotationFile, """{ "description": "from a file" }""")
+            try {
+                assetHelper.withCleaner(wsk.pkg, name) {
+                    (pkg, _) => wsk.cli(wp.overrides ++ Seq("package", "create", "--auth", wp.authKey, name,
+                        "--param-file", paramFile.getAbsolutePath(), "-p", "c", "cli",
+                        "--annotation-file", annotationFile.getAbsolutePath()))
+                }
+            } finally {
+                paramFile.delete()
+                annotationFile.delete()
+            }
+
+            val stdout = wsk.pkg.get(name).stdout
+            stdout should include regex (""""key": "a",\s+"value": 1""")
+            stdout should include regex (""""key": "b",\s+"value": \{\s+"x": true\s+\}""")
+            stdout should include regex (""""key": "c",\s+"value": "cli"""")
+            stdout should include regex (""""key": "description",\s+"value": "from a file"""")
+    }
+
+    it should "unbind a package binding but refuse to unbind a package" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "unbindPackage"
+            val bindName = "unbindBinding"
+            assetHelper.withCleaner(wsk.pkg, name) {
+                (pkg, _) => pkg.create(name)
+            }
+            assetHelper.withCleaner(wsk.pkg, bindName, confirmDelete = false) {
+                (pkg, _) => pkg.bind(name, bindName)
+            }
+
+            wsk.pkg.unbind(name, expectedExitCode = MISUSE_EXIT).
+                stdout should include("is not a binding")
+            wsk.pkg.get(name)
+            wsk.pkg.unbind(bindName)
+            wsk.pkg.get(bindName, expectedExitCode = NOT_FOUND)
+    }
+
+    it should "show the source of a package binding" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "bindingSourcePackage"
+            val bindName = "bindingSourceBinding"
+            assetHelper.withCleaner(wsk.pkg, name) {
+                (pkg, _) => pkg.create(name)
+            }
+            assetHelper.withCleaner(wsk.pkg, bindName) {
+                (pkg, _) => pkg.bind(name, bindName)
+            }
+
+            wsk.pkg.get(bindName).stdout should include regex (s"""binding -> /[^/]+/$name\n""")
+            wsk.cli(wp.overrides ++ Seq("package", "get", "--auth", wp.authKey, bindName, "--summary")).
+                stdout should include regex (s"""\\(binding -> /[^/]+/$name\\)""")
+            wsk.pkg.get(name).stdout should not include ("binding ->")
+    }
+
+    it should "exit with an error when package refresh fails" in {
+        val stdout = wsk.cli(wskprops.overrides ++ Seq("package", "refresh", "--auth", wskprops.authKey, "--json"), expectedExitCode = ANY_ERROR_EXIT).stdout
+        stdout should include("error:")
+        stdout should not include ("refreshed successfully")
+    }
+
+    it should "create, get and list actions in a package with spaces in its name" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val pkgName = "space package"
+            val actionName = s"$pkgName/space action"
+            assetHelper.withCleaner(wsk.pkg, pkgName) {
+                (pkg, name) => pkg.create(name)
+            }
+            assetHelper.withCleaner(wsk.action, actionName) {
+                (action, name) => action.create(name, defaultAction)
+            }
+            wsk.action.get(actionName).stdout should include(actionName)
+            wsk.action.list(Some(wsk.action.fqn(pkgName))).stdout should include(actionName)
+    }
+
+    it should "invoke an action in a package with the package in the route" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val pkgName = "invokePackage"
+            val actionName = s"$pkgName/invokeAction"
+            assetHelper.withCleaner(wsk.pkg, pkgName) {
+                (pkg, name) => pkg.create(name)
+            }
+            assetHelper.withCleaner(wsk.action, actionName) {
+                (action, name) => action.create(name, defaultAction)
+            }
+            val stdout = wsk.cli(wp.overrides ++ Seq("action", "invoke", "--auth", wp.authKey, actionName, "--blocking"), verbose = true).stdout
+            stdout should include regex (s"""POST .*/namespaces/_/actions/$actionName\\?blocking=true""")
+            stdout should include("ok: invoked")
+    }
+
     behavior of "Wsk Action CLI"
 
     it should "create the same action twice with different cases" in withAssetCleaner(wskprops) {
@@ -233,64 +831,749 @@ class WskBasicTests
             wsk.action.list().stdout should include(name)
     }
 
-    it should "get an action" in {
-        wsk.action.get("/whisk.system/samples/wordCount").
-            stdout should include("words")
-    }
+    it should "remove parameters and annotations from an action on update" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "deleteKeysAction"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, defaultAction, parameters = Map("a" -> "A".toJson, "b" -> "B".toJson), annotations = Map("c" -> "C".toJson))
+            }
+            wsk.cli(wp.overrides ++ Seq("action", "update", "--auth", wp.authKey, name, "--del-param", "a", "--del-annotation", "c", "-p", "d", "D"))
+            val stdout = wsk.action.get(name).stdout
+            stdout should not include regex (""""key": "a"""")
+            stdout should not include regex (""""key": "c"""")
+            stdout should include regex (""""key": "b",\s+"value": "B"""")
+            stdout should include regex (""""key": "d",\s+"value": "D"""")
 
-    it should "reject delete of action that does not exist" in {
-        wsk.action.sanitize("deleteFantasy").
-            stdout should include regex ("""error: The requested resource does not exist. \(code \d+\)""")
+            wsk.cli(wp.overrides ++ Seq("action", "update", "--auth", wp.authKey, name, "--del-param", "nope"), expectedExitCode = MISUSE_EXIT).
+                stdout should include(s"error: action $name has no parameter nope to remove")
+            wsk.cli(wp.overrides ++ Seq("action", "update", "--auth", wp.authKey, name, "--del-param", "nope", "--ignore-missing")).
+                stdout should include(s"ok: updated action $name")
     }
 
-    it should "reject create with missing file" in {
-        wsk.action.create("missingFile", Some("notfound"),
-            expectedExitCode = MISUSE_EXIT).
-            stdout should include("not a valid file")
+    it should "copy an action and retain its parameters unless overridden" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "copySource"
+            val copiedName = "copiedAction"
+            val execOnlyName = "copiedActionExecOnly"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, defaultAction, parameters = Map("a" -> "A".toJson, "b" -> "B".toJson))
+            }
+            assetHelper.withCleaner(wsk.action, copiedName) {
+                (action, _) => action.create(copiedName, Some(name), kind = Some("copy"), parameters = Map("b" -> "C".toJson))
+            }
+            assetHelper.withCleaner(wsk.action, execOnlyName) {
+                (action, _) => action.create(execOnlyName, Some(name), kind = Some("copy"), execOnly = true)
+            }
+
+            val copied = wsk.action.get(copiedName).stdout
+            copied should include regex (""""key": "a",\s+"value": "A"""")
+            copied should include regex (""""key": "b",\s+"value": "C"""")
+            copied should not include regex (""""value": "B"""")
+
+            val execOnly = wsk.action.get(execOnlyName).stdout
+            execOnly should not include regex (""""key": "a"""")
     }
 
-    /**
-     * Tests creating an action from a malformed js file. This should fail in
-     * some way - preferably when trying to create the action. If not, then
-     * surely when it runs there should be some indication in the logs. Don't
-     * think this is true currently.
-     */
-    it should "create and invoke action with malformed js resulting in activation error" in withAssetCleaner(wskprops) {
+    it should "copy an action from another namespace into the default namespace" in withAssetCleaner(wskprops) {
         (wp, assetHelper) =>
-            val name = "MALFORMED"
+            val name = "copiedFromSystem"
             assetHelper.withCleaner(wsk.action, name) {
-                (action, _) => action.create(name, Some(TestUtils.getTestActionFilename("malformed.js")))
+                (action, _) => action.create(name, Some("/whisk.system/samples/echo"), kind = Some("copy"))
             }
+            wsk.action.get(name).stdout should not include regex (""""namespace": "whisk.system"""")
 
-            val activation = wsk.action.invoke(name, Map("payload" -> "whatever".toJson))
-            val activationId = wsk.action.extractActivationId(activation)
-            activationId shouldBe a[Some[_]]
-
-            val expected = "ReferenceError" // representing nodejs giving an error when given malformed.js
-            val (found, logs) = wsk.activation.contains(activationId.get, expected)
-            assert(found, s"Did not find '$expected' in activation($activationId) ${logs getOrElse "empty"}")
+            wsk.action.create("copiedFromNowhere", Some("/whisk.system/samples/doesNotExist"), kind = Some("copy"), expectedExitCode = NOT_FOUND).
+                stdout should include("cannot read action /whisk.system/samples/doesNotExist to copy")
     }
 
-    it should "invoke a blocking action and get only the result" in withAssetCleaner(wskprops) {
+    it should "get the url of a web action and reject one that is not" in withAssetCleaner(wskprops) {
         (wp, assetHelper) =>
-            val name = "basicInvoke"
+            val webName = "webUrlAction"
+            val name = "notWebUrlAction"
+            assetHelper.withCleaner(wsk.action, webName) {
+                (action, _) => action.create(webName, defaultAction, annotations = Map("web-export" -> JsBoolean(true)))
+            }
             assetHelper.withCleaner(wsk.action, name) {
-                (action, _) => action.create(name, Some(TestUtils.getCatalogFilename("samples/wc.js")))
+                (action, _) => action.create(name, defaultAction)
             }
-            wsk.action.invoke(name, Map("payload" -> "one two three".toJson), blocking = true, result = true)
-                .stdout should include regex (""""count": 3""")
+            wsk.cli(wp.overrides ++ Seq("action", "get", "--auth", wp.authKey, webName, "--url")).
+                stdout should include regex (s"""https://${wp.apihost}/api/v1/web/[^/]+/default/$webName\n""")
+            wsk.cli(wp.overrides ++ Seq("action", "get", "--auth", wp.authKey, name, "--url"), expectedExitCode = MISUSE_EXIT).
+                stderr should include("is not a web action")
     }
 
-    behavior of "Wsk Trigger CLI"
+    it should "keep the last of duplicate parameters or reject them with strict keys" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "duplicateKeysAction"
+            val create = Seq("action", "create", "--auth", wp.authKey, name, defaultAction.get, "-p", "foo", "1", "-p", "foo", "2")
+            wsk.cli(wp.overrides ++ create :+ "--strict-keys", expectedExitCode = MISUSE_EXIT).
+                stdout should include("error: parameter foo is given more than once")
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => wsk.cli(wp.overrides ++ create)
+            }.stderr should include("warning: parameter foo is given more than once; using the last value")
+            val stdout = wsk.action.get(name).stdout
+            stdout should include regex (""""key": "foo",\s+"value": 2""")
+            stdout should not include regex (""""value": 1""")
+    }
 
-    it should "create trigger, get trigger, update trigger and list trigger" in withAssetCleaner(wskprops) {
+    it should "show the actions of a sequence in order" in withAssetCleaner(wskprops) {
         (wp, assetHelper) =>
-            val name = "listTriggers"
-            val params = Map("a" -> "A".toJson)
-            assetHelper.withCleaner(wsk.trigger, name) {
-                (trigger, _) =>
-                    trigger.create(name, parameters = params, shared = Some(true))
-                    trigger.create(name, update = true)
+            val name = "showSequence"
+            val components = Seq("showSequenceFirst", "showSequenceSecond")
+            components foreach { c =>
+                assetHelper.withCleaner(wsk.action, c) {
+                    (action, _) => action.create(c, defaultAction)
+                }
+            }
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, Some(components.mkString(",")), kind = Some("sequence"))
+            }
+
+            val order = s"/[^/]+/${components(0)} -> /[^/]+/${components(1)}"
+            wsk.action.get(name).stdout should include regex (s"sequence: $order\n")
+            wsk.cli(wp.overrides ++ Seq("action", "get", "--auth", wp.authKey, name, "--summary")).
+                stdout should include regex (s"\\(sequence: $order\\)")
+            wsk.action.get(components(0)).stdout should not include ("sequence:")
+    }
+
+    it should "summarize descriptions that are not strings as JSON" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "summaryDescription"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, defaultAction)
+            }
+            Seq(
+                "a string" -> "a string",
+                "true" -> "true",
+                "42" -> "42",
+                """[1, "a"]""" -> """[1,"a"]""",
+                """{"b": 1, "a": [false]}""" -> """{"a":[false],"b":1}""") foreach {
+                    case (value, shown) =>
+                        wsk.cli(wp.overrides ++ Seq("action", "update", "--auth", wp.authKey, name, "-a", "description", value))
+                        wsk.cli(wp.overrides ++ Seq("action", "get", "--auth", wp.authKey, name, "--summary")).
+                            stdout should include(s"$name: $shown\n")
+                }
+    }
+
+    it should "annotate a conductor action" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "conductorAction"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => wsk.cli(wp.overrides ++ Seq("action", "create", "--auth", wp.authKey, name, defaultAction.get, "--conductor"))
+            }
+            wsk.action.get(name).stdout should include regex (""""key": "conductor",\s+"value": true""")
+
+            wsk.cli(wp.overrides ++ Seq("action", "update", "--auth", wp.authKey, name, "--conductor=false"))
+            wsk.action.get(name).stdout should include regex (""""key": "conductor",\s+"value": false""")
+
+            wsk.cli(wp.overrides ++ Seq("action", "update", "--auth", wp.authKey, name, "-a", "description", "plain"))
+            wsk.action.get(name).stdout should not include ("conductor")
+    }
+
+    it should "print parameters sorted by key when asked" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "sortParamsAction"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, defaultAction, parameters = Map("zz" -> "1".toJson, "aa" -> "2".toJson, "mm" -> "3".toJson))
+            }
+            val get = wp.overrides ++ Seq("--sort-params", "action", "get", "--auth", wp.authKey, name)
+            val stdout = wsk.cli(get).stdout
+            stdout should include regex (""""key": "aa"[\s\S]*"key": "mm"[\s\S]*"key": "zz"""")
+            wsk.cli(get).stdout shouldBe stdout
+    }
+
+    it should "create an action with annotations from a file" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "annotationFileAction"
+            val annotationFile = File.createTempFile("annotations", ".json")
+            FileUtils.writeStringToFile(annotationFile, """{ "web-export": true, "meta": { "tags": [ "a", "b" ] }, "x": "file" }""")
+            try {
+                assetHelper.withCleaner(wsk.action, name) {
+                    (action, _) =>
+                        action.create(name, defaultAction, annotationFile = Some(annotationFile.getAbsolutePath()))
+                        wsk.cli(wp.overrides ++ Seq("action", "update", "--auth", wp.authKey, name, "--annotation-file", annotationFile.getAbsolutePath(), "-a", "x", "cli"))
+                }
+            } finally {
+                annotationFile.delete()
+            }
+
+            val stdout = wsk.action.get(name).stdout
+            stdout should include regex (""""key": "web-export",\s+"value": true""")
+            stdout should include regex (""""key": "meta",\s+"value": \{\s+"tags": \[\s+"a",\s+"b"\s+\]""")
+            stdout should include regex (""""key": "x",\s+"value": "cli"""")
+    }
+
+    it should "list only shared actions" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val sharedName = "listSharedAction"
+            val privateName = "listPrivateAction"
+            assetHelper.withCleaner(wsk.action, sharedName) {
+                (action, _) => action.create(sharedName, defaultAction, shared = Some(true))
+            }
+            assetHelper.withCleaner(wsk.action, privateName) {
+                (action, _) => action.create(privateName, defaultAction)
+            }
+            val stdout = wsk.cli(wp.overrides ++ Seq("action", "list", "--auth", wp.authKey, "--shared"), verbose = true).stdout
+            stdout should include regex ("""GET .*/actions\?.*public=true""")
+            stdout should include(sharedName)
+            stdout should not include (privateName)
+    }
+
+    it should "list only actions whose name starts with a prefix" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val matchingName = "listPrefixAction"
+            val otherName = "listOtherAction"
+            Seq(matchingName, otherName) foreach { name =>
+                assetHelper.withCleaner(wsk.action, name) {
+                    (action, _) => action.create(name, defaultAction)
+                }
+            }
+            val stdout = wsk.cli(wp.overrides ++ Seq("action", "list", "--auth", wp.authKey, "--name", "listPrefix"), verbose = true).stdout
+            stdout should include regex ("""GET .*/actions\?.*name=listPrefix""")
+            stdout should include(matchingName)
+            stdout should not include (otherName)
+    }
+
+    it should "list the version of actions only when asked" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "listVersionAction"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, defaultAction)
+            }
+            val list = Seq("action", "list", "--auth", wp.authKey, "--name", name)
+            wsk.cli(wp.overrides ++ list ++ Seq("--show-version")).stdout should include regex (s"""$name\\s+private\\s+0\\.0\\.1""")
+            wsk.cli(wp.overrides ++ list).stdout should not include ("0.0.1")
+    }
+
+    it should "end a list of packages with the number of packages listed" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val names = Seq("countPackage1", "countPackage2")
+            names foreach { name =>
+                assetHelper.withCleaner(wsk.pkg, name) {
+                    (pkg, _) => pkg.create(name)
+                }
+            }
+            val lines = wsk.cli(wp.overrides ++ Seq("package", "list", "--auth", wp.authKey, "--count", "--limit", "200")).stdout.lines.toList
+            // the collection header, the packages and the count
+            lines.last shouldBe s"${lines.length - 2} packages"
+            names foreach { name => lines.exists(_.contains(name)) shouldBe true }
+            wsk.pkg.list().stdout should not include regex ("""\d+ packages""")
+    }
+
+    it should "list actions grouped by package" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val packages = Seq("byPackageB", "byPackageA")
+            packages foreach { p =>
+                assetHelper.withCleaner(wsk.pkg, p) {
+                    (pkg, _) => pkg.create(p)
+                }
+            }
+            val actions = Seq("byPackageB/inB", "byPackageA/inA", "byPackageDefault")
+            actions foreach { a =>
+                assetHelper.withCleaner(wsk.action, a) {
+                    (action, _) => action.create(a, defaultAction)
+                }
+            }
+            val stdout = wsk.cli(wp.overrides ++ Seq("action", "list", "--auth", wp.authKey, "--limit", "0", "--by-package")).stdout
+            stdout should include regex ("""(?s)\(default\)\n.*/byPackageDefault.*\nbyPackageA\n/[^/]+/byPackageA/inA.*\nbyPackageB\n/[^/]+/byPackageB/inB""")
+    }
+
+    it should "list full documents of triggers, actions, packages and rules when asked" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val triggerName = "listFullTrigger"
+            val actionName = "listFullAction"
+            val packageName = "listFullPackage"
+            val ruleName = "listFullRule"
+            assetHelper.withCleaner(wsk.trigger, triggerName) {
+                (trigger, _) => trigger.create(triggerName, parameters = Map("fullKey" -> "fullValue".toJson))
+            }
+            assetHelper.withCleaner(wsk.action, actionName) {
+                (action, _) => action.create(actionName, defaultAction)
+            }
+            assetHelper.withCleaner(wsk.pkg, packageName) {
+                (pkg, _) => pkg.create(packageName)
+            }
+            assetHelper.withCleaner(wsk.rule, ruleName) {
+                (rule, _) => rule.create(ruleName, trigger = triggerName, action = actionName)
+            }
+
+            val triggers = wsk.cli(wp.overrides ++ Seq("trigger", "list", "--auth", wp.authKey, "--full"), verbose = true).stdout
+            triggers should include regex (s"""GET .*/triggers/$triggerName""")
+            triggers should include regex (s""""name": "$triggerName"""")
+            triggers should include regex (""""key": "fullKey",\s+"value": "fullValue"""")
+
+            Seq(("action", actionName), ("package", packageName), ("rule", ruleName)) foreach {
+                case (noun, name) =>
+                    wsk.cli(wp.overrides ++ Seq(noun, "list", "--auth", wp.authKey, "--full")).
+                        stdout should include regex (s""""name": "$name"""")
+            }
+            wsk.cli(wp.overrides ++ Seq("rule", "list", "--auth", wp.authKey, "--trigger", triggerName, "--full")).
+                stdout should include regex (s""""action": "$actionName"""")
+    }
+
+    it should "take limits from annotations only when no limit flags are given" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "annotationLimits"
+            val flagName = "annotationLimitsWithFlags"
+            val limits = Seq("-a", "timeout", "10000", "-a", "memory", "512")
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => wsk.cli(wp.overrides ++ Seq("action", "create", "--auth", wp.authKey, name, defaultAction.get) ++ limits)
+            }
+            assetHelper.withCleaner(wsk.action, flagName) {
+                (action, _) => wsk.cli(wp.overrides ++ Seq("action", "create", "--auth", wp.authKey, flagName, defaultAction.get, "-t", "20000", "-m", "256") ++ limits)
+            }
+
+            val fromAnnotations = wsk.action.get(name).stdout
+            fromAnnotations should include regex (""""timeout": 10000""")
+            fromAnnotations should include regex (""""memory": 512""")
+
+            val fromFlags = wsk.action.get(flagName).stdout
+            fromFlags should include regex (""""timeout": 20000""")
+            fromFlags should include regex (""""memory": 256""")
+    }
+
+    it should "reject a parameter file that holds a JSON array" in {
+        val paramFile = File.createTempFile("params", ".json")
+        FileUtils.writeStringToFile(paramFile, "[ 1, 2 ]")
+        try {
+            wsk.cli(wskprops.overrides ++ Seq("package", "create", "--auth", wskprops.authKey, "arrayParamFile", "--param-file", paramFile.getAbsolutePath()), expectedExitCode = MISUSE_EXIT).
+                stdout should include(s"file ${paramFile.getAbsolutePath()} must contain a JSON object")
+            wsk.pkg.get("arrayParamFile", expectedExitCode = NOT_FOUND)
+        } finally {
+            paramFile.delete()
+        }
+    }
+
+    it should "reject an annotation file that is not a JSON object" in {
+        val annotationFile = File.createTempFile("annotations", ".json")
+        FileUtils.writeStringToFile(annotationFile, "[ 1, 2 ]")
+        try {
+            val stdout = wsk.cli(wskprops.overrides ++ Seq("action", "create", "--auth", wskprops.authKey, "badAnnotationFile", defaultAction.get, "--annotation-file", annotationFile.getAbsolutePath()), expectedExitCode = MISUSE_EXIT).stdout
+            stdout should include("must contain a JSON object")
+        } finally {
+            annotationFile.delete()
+        }
+    }
+
+    it should "name an annotation file that is missing or not valid JSON and where it is not valid" in {
+        val annotationFile = File.createTempFile("annotations", ".json")
+        val missingFile = new File(annotationFile.getAbsolutePath() + ".missing")
+        FileUtils.writeStringToFile(annotationFile, "{ \"a\": 1,\n  \"b\" 2 }")
+        def create(file: File) = wsk.cli(wskprops.overrides ++ Seq("action", "create", "--auth", wskprops.authKey, "badAnnotationFile", defaultAction.get, "--annotation-file", file.getAbsolutePath()), expectedExitCode = MISUSE_EXIT).stdout
+        try {
+            create(annotationFile) should include(s"error: file ${annotationFile.getAbsolutePath()} is not valid JSON: Expecting : delimiter: line 2 column")
+            create(missingFile) should include(s"error: cannot read file ${missingFile.getAbsolutePath()}: No such file or directory")
+        } finally {
+            annotationFile.delete()
+        }
+    }
+
+    it should "accept shared values regardless of case and reject unknown values" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "sharedValues"
+            val create = Seq("action", "create", "--auth", wskprops.authKey, name, defaultAction.get)
+            val update = Seq("action", "update", "--auth", wskprops.authKey, name)
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => wsk.cli(wskprops.overrides ++ create ++ Seq("--shared", "YES"))
+            }
+            wsk.action.get(name).stdout should include regex (""""publish": true""")
+
+            wsk.cli(wskprops.overrides ++ update ++ Seq("--shared", "No"))
+            wsk.action.get(name).stdout should include regex (""""publish": false""")
+
+            wsk.cli(wskprops.overrides ++ update ++ Seq("--shared", "maybe"), expectedExitCode = MISUSE_EXIT).
+                stderr should include("invalid choice")
+    }
+
+    it should "get an action" in {
+        wsk.action.get("/whisk.system/samples/wordCount").
+            stdout should include("words")
+    }
+
+    it should "get only the code of an action" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "getCode"
+            val dockerName = "getCodeDocker"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, defaultAction)
+            }
+            assetHelper.withCleaner(wsk.action, dockerName) {
+                (action, _) => action.create(dockerName, Some("fake/image"), kind = Some("docker"))
+            }
+
+            val code = wsk.cli(wskprops.overrides ++ Seq("action", "get", "--auth", wskprops.authKey, name, "--code"))
+            code.stdout shouldBe FileUtils.readFileToString(new File(defaultAction.get))
+
+            val docker = wsk.cli(wskprops.overrides ++ Seq("action", "get", "--auth", wskprops.authKey, dockerName, "--code"),
+                expectedExitCode = MISUSE_EXIT)
+            docker.stdout shouldBe empty
+            docker.stderr should include("is not text")
+    }
+
+    it should "get an action exactly as the server returns it with raw" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "getRaw"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, defaultAction)
+            }
+            def get(flags: String*) = wsk.cli(wskprops.overrides ++ Seq("action", "get", "--auth", wskprops.authKey, name) ++ flags)
+
+            val raw = get("--raw").stdout
+            raw should not include ("ok: got")
+            val pretty = get().stdout
+            raw.parseJson shouldBe pretty.substring(pretty.indexOf('{')).parseJson
+            wsk.cli(wskprops.overrides ++ Seq("action", "get", "--auth", wskprops.authKey, name, "--raw", "--code"),
+                expectedExitCode = MISUSE_EXIT).stderr should include("not allowed with argument")
+    }
+
+    it should "reject delete of action that does not exist" in {
+        wsk.action.sanitize("deleteFantasy").
+            stdout should include regex ("""error: The requested resource does not exist. \(code \d+\)""")
+    }
+
+    it should "reject create and update given more than one kind of artifact" in {
+        Seq("create", "update") foreach { cmd =>
+            Seq(("--docker", "--copy"), ("--docker", "--sequence"), ("--copy", "--sequence")) foreach {
+                case (first, second) =>
+                    wsk.cli(wskprops.overrides ++ Seq("action", cmd, "--auth", wskprops.authKey, "conflictingKinds", "artifact", first, second), expectedExitCode = MISUSE_EXIT).
+                        stderr should include(s"argument $second: not allowed with argument $first")
+            }
+        }
+    }
+
+    it should "reject create and update from a directory" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "directoryArtifact"
+            val dir = Files.createTempDirectory("action").toFile
+            try {
+                wsk.action.create(name, Some(dir.getAbsolutePath()), expectedExitCode = MISUSE_EXIT).
+                    stdout should include(s"the artifact ${dir.getAbsolutePath()} is a directory")
+                assetHelper.withCleaner(wsk.action, name) {
+                    (action, _) => action.create(name, defaultAction)
+                }
+                wsk.action.create(name, Some(dir.getAbsolutePath()), update = true, expectedExitCode = MISUSE_EXIT).
+                    stdout should include(s"the artifact ${dir.getAbsolutePath()} is a directory")
+            } finally {
+                FileUtils.deleteDirectory(dir)
+            }
+    }
+
+    it should "reject create from an empty or whitespace only file" in {
+        val empty = File.createTempFile("empty", ".js")
+        val blank = File.createTempFile("blank", ".js")
+        try {
+            FileUtils.writeStringToFile(blank, "  \n\t\n")
+            Seq(empty, blank) foreach { file =>
+                wsk.action.create("emptyArtifact", Some(file.getAbsolutePath()), expectedExitCode = MISUSE_EXIT).
+                    stdout should include(s"the artifact ${file.getAbsolutePath()} is empty")
+            }
+        } finally {
+            empty.delete()
+            blank.delete()
+        }
+    }
+
+    it should "reject create with missing file" in {
+        wsk.action.create("missingFile", Some("notfound"),
+            expectedExitCode = MISUSE_EXIT).
+            stdout should include("not a valid file")
+    }
+
+    /**
+     * Tests creating an action from a malformed js file. This should fail in
+     * some way - preferably when trying to create the action. If not, then
+     * surely when it runs there should be some indication in the logs. Don't
+     * think this is true currently.
+     */
+    it should "create and invoke action with malformed js resulting in activation error" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "MALFORMED"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, Some(TestUtils.getTestActionFilename("malformed.js")))
+            }
+
+            val activation = wsk.action.invoke(name, Map("payload" -> "whatever".toJson))
+            val activationId = wsk.action.extractActivationId(activation)
+            activationId shouldBe a[Some[_]]
+
+            val expected = "ReferenceError" // representing nodejs giving an error when given malformed.js
+            val (found, logs) = wsk.activation.contains(activationId.get, expected)
+            assert(found, s"Did not find '$expected' in activation($activationId) ${logs getOrElse "empty"}")
+    }
+
+    it should "invoke a blocking action and get only the result" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "basicInvoke"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, Some(TestUtils.getCatalogFilename("samples/wc.js")))
+            }
+            wsk.action.invoke(name, Map("payload" -> "one two three".toJson), blocking = true, result = true)
+                .stdout should include regex (""""count": 3""")
+    }
+
+    it should "invoke an action with metadata under a reserved key apart from the parameters" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "metaInvoke"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, Some(TestUtils.getCatalogFilename("samples/echo.js")))
+            }
+            val stdout = wsk.cli(wp.overrides ++ Seq("action", "invoke", "--auth", wp.authKey, name, "-b", "-r", "-p", "a", "A", "--meta", "x-request-id=1234")).stdout
+            stdout should include regex (""""__ow_meta": \{\s+"x-request-id": "1234"\s+\}""")
+            stdout should include regex (""""a": "A"""")
+    }
+
+    it should "invoke an action with a payload, rejecting a JSON array and keeping the type of a scalar" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "payloadInvoke"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, Some(TestUtils.getCatalogFilename("samples/echo.js")))
+            }
+            def invoke(payload: String, expectedExitCode: Int = SUCCESS_EXIT) = wsk.cli(wp.overrides ++
+                Seq("action", "invoke", "--auth", wp.authKey, name, payload, "-b", "-r", "-p", "a", "A"), expectedExitCode).stdout
+
+            val fields = invoke("""{"x": 1}""").parseJson.asJsObject.fields
+            fields("x") shouldBe 1.toJson
+            fields("a") shouldBe "A".toJson
+            invoke("42").parseJson.asJsObject.fields("payload") shouldBe 42.toJson
+            invoke("true").parseJson.asJsObject.fields("payload") shouldBe true.toJson
+            invoke("some text").parseJson.asJsObject.fields("payload") shouldBe "some text".toJson
+            invoke("[1, 2]", MISUSE_EXIT) should include("error: the payload is a JSON array; it must be a JSON object")
+    }
+
+    it should "accept parameters given as a key and value or as key=value" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "keyValueInvoke"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, Some(TestUtils.getCatalogFilename("samples/echo.js")))
+            }
+            val params = Seq("-p", "a", "A", "-p", "b=B", "--param", "c=x=y", "-p", "d", "e=f")
+            val result = wsk.cli(wp.overrides ++ Seq("action", "invoke", "--auth", wp.authKey, name, "-b", "-r") ++ params).stdout.parseJson.asJsObject
+            result.fields("a") shouldBe "A".toJson
+            result.fields("b") shouldBe "B".toJson
+            result.fields("c") shouldBe "x=y".toJson
+            result.fields("d") shouldBe "e=f".toJson
+
+            wsk.cli(wp.overrides ++ Seq("action", "invoke", "--auth", wp.authKey, name, "-p", "a"), expectedExitCode = MISUSE_EXIT).
+                stdout should include("-p a must be given as KEY VALUE or KEY=VALUE")
+    }
+
+    it should "invoke a blocking action and get only a large result" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "largeResult"
+            val count = 5000
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, Some(TestUtils.getTestActionFilename("largeResult.js")))
+            }
+            val result = wsk.action.invoke(name, Map("count" -> JsNumber(count)), blocking = true, result = true).stdout.parseJson.asJsObject
+            result.fields.size shouldBe count
+            result.fields("key0") shouldBe ("x" * 100).toJson
+    }
+
+    it should "show the default parameters an invoke overrides" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "showDefaults"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, defaultAction, parameters = Map("a" -> "A".toJson, "b" -> "B".toJson))
+            }
+            val run = wsk.cli(wp.overrides ++ Seq("action", "invoke", "--auth", wp.authKey, name, "--show-defaults", "-p", "b", "C", "-p", "c", "D"))
+            run.stderr should include("default parameters: a, b")
+            run.stderr should include("overridden by invoke: b\n")
+            run.stdout should include("ok: invoked")
+    }
+
+    it should "refuse to invoke with a payload larger than the limit" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "payloadLimit"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, defaultAction)
+            }
+            // the payload is {"s": "0123456789"} which is 19 bytes
+            val invoke = Seq("action", "invoke", "--auth", wp.authKey, name, "-p", "s", "0123456789", "--max-payload")
+            wsk.cli(wp.overrides ++ invoke :+ "19").stdout should include("ok: invoked")
+            wsk.cli(wp.overrides ++ invoke :+ "18", expectedExitCode = MISUSE_EXIT).
+                stdout should include("the payload is 19 bytes, more than the 18 bytes")
+    }
+
+    it should "save the activation ids of invokes to a file" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "saveActivationId"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, defaultAction)
+            }
+            val dir = Files.createTempDirectory("activations").toFile
+            val idFile = new File(dir, "nested/ids")
+            try {
+                val invoke = Seq("action", "invoke", "--auth", wp.authKey, name, "--save-activation-id", idFile.getAbsolutePath())
+                val activationId = wsk.action.extractActivationId(wsk.cli(wp.overrides ++ invoke))
+                activationId shouldBe a[Some[_]]
+                FileUtils.readFileToString(idFile) shouldBe s"${activationId.get}\n"
+
+                val ids = "ok: invoked .* with id (\\w+)".r.findAllMatchIn(wsk.cli(wp.overrides ++ invoke ++ Seq("--repeat", "2")).stdout).map(_.group(1)).toList
+                ids should have size 2
+                FileUtils.readFileToString(idFile).lines.toList should contain theSameElementsAs (activationId.get :: ids)
+            } finally {
+                FileUtils.deleteDirectory(dir)
+            }
+    }
+
+    it should "show the duration and status of a blocking invoke only when verbose" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "timedInvoke"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, defaultAction)
+            }
+            val timing = """activation \w+: success, duration \d+ ms \(start .+, end .+\)"""
+            val invoke = Seq("action", "invoke", "--auth", wp.authKey, name, "--blocking")
+            wsk.cli(wp.overrides ++ invoke, verbose = true).stdout should include regex (timing)
+            wsk.cli(wp.overrides ++ invoke :+ "--result", verbose = true).stdout should include regex (timing)
+            wsk.cli(wp.overrides ++ invoke).stdout should not include regex (timing)
+    }
+
+    it should "invoke an action repeatedly and report the activation ids" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "repeatInvoke"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, defaultAction)
+            }
+            val run = wsk.cli(wp.overrides ++ Seq("action", "invoke", "--auth", wp.authKey, name, "--repeat", "3", "--concurrency", "2"))
+            "ok: invoked".r.findAllIn(run.stdout).length shouldBe 3
+            run.stdout should include("ok: 3 invokes succeeded")
+
+            wsk.cli(wp.overrides ++ Seq("action", "invoke", "--auth", wp.authKey, name, "--repeat", "3", "--blocking"), expectedExitCode = MISUSE_EXIT).
+                stdout should include("cannot be used with --blocking")
+
+            // the same without reusing connections between requests
+            wsk.cli(wp.overrides ++ Seq("--no-keep-alive", "action", "invoke", "--auth", wp.authKey, name, "--repeat", "3", "--concurrency", "2")).
+                stdout should include("ok: 3 invokes succeeded")
+    }
+
+    it should "invoke a blocking action that fails and get only the error result on stderr" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "basicInvokeError"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, Some(TestUtils.getTestActionFilename("applicationError1.js")))
+            }
+            val run = wsk.action.invoke(name, blocking = true, result = true, expectedExitCode = TIMEOUT)
+            run.stdout shouldBe empty
+            run.stderr should include("This error thrown on purpose by the action.")
+    }
+
+    it should "show the invoke payload in verbose mode with secrets masked" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "verbosePayload"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, defaultAction)
+            }
+            val invoke = Seq("action", "invoke", "--auth", wskprops.authKey, name, "-p", "user", "someone", "-p", "password", "hunter2")
+
+            val masked = wsk.cli(wskprops.overrides ++ invoke, verbose = true)
+            masked.stderr should include("Payload:")
+            masked.stderr should include regex (""""user": "someone"""")
+            masked.stderr should include regex (""""password": "\*+"""")
+            masked.stdout + masked.stderr should not include ("hunter2")
+
+            wsk.cli(wskprops.overrides ++ invoke :+ "--show-secrets", verbose = true).
+                stderr should include regex (""""password": "hunter2"""")
+    }
+
+    behavior of "Wsk Activation CLI"
+
+    it should "list full activation records with --full" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "listFullActivations"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, Some(TestUtils.getCatalogFilename("samples/echo.js")))
+            }
+            val activationId = wsk.action.extractActivationId(wsk.action.invoke(name, Map("payload" -> "full".toJson)))
+            activationId shouldBe a[Some[_]]
+            wsk.activation.pollFor(N = 1, Some(name)) should contain(activationId.get)
+
+            val stdout = wsk.cli(wskprops.overrides ++ Seq("activation", "list", "--auth", wskprops.authKey, name, "--full"), verbose = true).stdout
+            stdout should include regex ("""GET .*/activations\?docs=true""")
+            stdout should include regex (s""""activationId": "${activationId.get}"""")
+            stdout should include regex (""""payload": "full"""")
+    }
+
+    it should "list activations in a time window given as dates" in {
+        def list(since: String, expectedExitCode: Int = SUCCESS_EXIT) = wsk.cli(wskprops.overrides ++
+            Seq("activation", "list", "--auth", wskprops.authKey, "--since", since, "--upto", "2016-01-03T00:00:00+01:00"),
+            expectedExitCode, verbose = true, env = Map("TZ" -> "UTC"))
+
+        list("2016-01-02T15:04:05Z").stdout should include("since=1451747045000")
+        list("2016-01-02 15:04").stdout should include("since=1451747040000")
+        list("2016-01-02").stdout should include("upto=1451775600000")
+        list("yesterday", MISUSE_EXIT).stderr should include("""cannot parse the time "yesterday"""")
+    }
+
+    it should "get the last activation of an action" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "lastActivation"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, Some(TestUtils.getCatalogFilename("samples/echo.js")))
+            }
+            val activationId = wsk.action.extractActivationId(wsk.action.invoke(name, Map("payload" -> "last".toJson)))
+            activationId shouldBe a[Some[_]]
+            wsk.activation.pollFor(N = 1, Some(name)) should contain(activationId.get)
+
+            val last = Seq("--auth", wskprops.authKey, "--last", "--action", name)
+            wsk.cli(wskprops.overrides ++ Seq("activation", "get") ++ last).
+                stdout should include(activationId.get)
+            wsk.cli(wskprops.overrides ++ Seq("activation", "result") ++ last).
+                stdout should include regex (""""payload": "last"""")
+    }
+
+    it should "get an activation together with its logs" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "activationWithLogs"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, defaultAction)
+            }
+            val activationId = wsk.action.extractActivationId(wsk.action.invoke(name, Map("payload" -> "logs".toJson)))
+            activationId shouldBe a[Some[_]]
+            wsk.activation.pollFor(N = 1, Some(name)) should contain(activationId.get)
+
+            val stdout = wsk.cli(wp.overrides ++ Seq("activation", "get", "--auth", wp.authKey, activationId.get, "--logs")).stdout
+            stdout should include regex (s""""activationId": "${activationId.get}"""")
+            stdout should include regex ("""(?s)logs:\n.*hello logs!""")
+            stdout should not include (""""logs":""")
+    }
+
+    it should "get only the result of an activation with quiet and exit non-zero if it failed" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "quietResult"
+            val errorName = "quietResultError"
+            assetHelper.withCleaner(wsk.action, name) {
+                (action, _) => action.create(name, Some(TestUtils.getCatalogFilename("samples/echo.js")))
+            }
+            assetHelper.withCleaner(wsk.action, errorName) {
+                (action, _) => action.create(errorName, Some(TestUtils.getTestActionFilename("applicationError1.js")))
+            }
+
+            Seq((name, SUCCESS_EXIT, """{"payload": "quiet"}"""), (errorName, TIMEOUT, """{"error": "This error thrown on purpose by the action."}""")) foreach {
+                case (action, exitCode, expected) =>
+                    val activationId = wsk.action.extractActivationId(wsk.action.invoke(action, Map("payload" -> "quiet".toJson)))
+                    activationId shouldBe a[Some[_]]
+                    wsk.activation.pollFor(N = 1, Some(action)) should contain(activationId.get)
+                    wsk.cli(wp.overrides ++ Seq("activation", "result", "--auth", wp.authKey, activationId.get, "--quiet"), exitCode).
+                        stdout.trim shouldBe expected
+            }
+    }
+
+    it should "reject getting the last activation of an action that has none" in {
+        wsk.cli(wskprops.overrides ++ Seq("activation", "get", "--auth", wskprops.authKey, "--last", "--action", "noActivations"),
+            expectedExitCode = NOT_FOUND).stdout should include("there are no activations")
+    }
+
+    behavior of "Wsk Trigger CLI"
+
+    it should "create trigger, get trigger, update trigger and list trigger" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "listTriggers"
+            val params = Map("a" -> "A".toJson)
+            assetHelper.withCleaner(wsk.trigger, name) {
+                (trigger, _) =>
+                    trigger.create(name, parameters = params, shared = Some(true))
+                    trigger.create(name, update = true)
             }
             val stdout = wsk.trigger.get(name).stdout
             stdout should include regex (""""key": "a"""")
@@ -300,6 +1583,40 @@ class WskBasicTests
             wsk.trigger.list().stdout should include(name)
     }
 
+    it should "merge parameters into a trigger on update and keep it shared" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "mergeTrigger"
+            assetHelper.withCleaner(wsk.trigger, name) {
+                (trigger, _) => trigger.create(name, parameters = Map("a" -> "A".toJson, "b" -> "B".toJson), shared = Some(true))
+            }
+            wsk.cli(wp.overrides ++ Seq("trigger", "update", "--auth", wp.authKey, name, "--merge", "-p", "b", "C", "-p", "c", "D"))
+            val stdout = wsk.trigger.get(name).stdout
+            stdout should include regex (""""key": "a",\s+"value": "A"""")
+            stdout should include regex (""""key": "b",\s+"value": "C"""")
+            stdout should include regex (""""key": "c",\s+"value": "D"""")
+            stdout should include regex (""""publish": true""")
+    }
+
+    it should "invoke the feed action when creating and deleting a trigger with a feed" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val triggerName = "feedTrigger"
+            val feedName = "feedAction"
+            assetHelper.withCleaner(wsk.action, feedName) {
+                (action, name) => action.create(name, Some(TestUtils.getCatalogFilename("samples/echo.js")))
+            }
+            assetHelper.withCleaner(wsk.trigger, triggerName, confirmDelete = false) {
+                (trigger, name) => trigger.create(name, feed = Some(feedName))
+            }
+            wsk.trigger.get(triggerName).stdout should include regex (""""key": "feed"""")
+            wsk.trigger.delete(triggerName)
+
+            val events = wsk.activation.pollFor(N = 2, Some(feedName)) map { wsk.activation.get(_).stdout }
+            events.length shouldBe 2
+            events.mkString should include regex (""""lifecycleEvent": "CREATE"""")
+            events.mkString should include regex (""""lifecycleEvent": "DELETE"""")
+            events.mkString should include(s""""triggerName": "${wsk.trigger.fqn(triggerName)}"""")
+    }
+
     behavior of "Wsk Rule CLI"
 
     it should "create rule, get rule, update rule and list rule" in withAssetCleaner(wskprops) {
@@ -325,6 +1642,155 @@ class WskBasicTests
             stdout should include(actionName)
             stdout should include regex (""""version": "0.0.2"""")
             wsk.rule.list().stdout should include(ruleName)
+
+            val summary = wsk.cli(wp.overrides ++ Seq("rule", "get", "--auth", wp.authKey, ruleName, "--summary")).stdout
+            summary should include("(status: inactive)")
+            summary should include(s"(fires: $triggerName -> $actionName)")
+            wsk.rule.checkRuleState(ruleName, active = false) shouldBe true
+    }
+
+    it should "delete the rules that fire an action deleted with cascade" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val triggerName = "cascadeTrigger"
+            val actionName = "cascadeAction"
+            val otherActionName = "cascadeOtherAction"
+            val rules = Seq(("cascadeRuleActive", actionName, true), ("cascadeRuleInactive", actionName, false), ("cascadeRuleOther", otherActionName, false))
+            assetHelper.withCleaner(wsk.trigger, triggerName) {
+                (trigger, name) => trigger.create(name)
+            }
+            assetHelper.withCleaner(wsk.action, actionName, confirmDelete = false) {
+                (action, name) => action.create(name, defaultAction)
+            }
+            assetHelper.withCleaner(wsk.action, otherActionName) {
+                (action, name) => action.create(name, defaultAction)
+            }
+            rules foreach {
+                case (ruleName, action, enable) =>
+                    assetHelper.withCleaner(wsk.rule, ruleName, confirmDelete = action != actionName) {
+                        (rule, name) => rule.create(name, trigger = triggerName, action = action, enable = enable)
+                    }
+            }
+
+            val stdout = wsk.cli(wp.overrides ++ Seq("action", "delete", "--auth", wp.authKey, actionName, "--cascade")).stdout
+            stdout should include(s"ok: deleted $actionName")
+            stdout should include regex ("ok: deleted /[^/]+/cascadeRuleActive")
+            stdout should include regex ("ok: deleted /[^/]+/cascadeRuleInactive")
+            stdout should not include ("cascadeRuleOther")
+            wsk.rule.get("cascadeRuleActive", expectedExitCode = NOT_FOUND)
+            wsk.rule.get("cascadeRuleOther")
+    }
+
+    it should "create and enable a rule in one step" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val ruleName = "createEnabledRule"
+            val triggerName = "createEnabledTrigger"
+            val actionName = "createEnabledAction"
+            assetHelper.withCleaner(wsk.trigger, triggerName) {
+                (trigger, name) => trigger.create(name)
+            }
+            assetHelper.withCleaner(wsk.action, actionName) {
+                (action, name) => action.create(name, defaultAction)
+            }
+            val stdout = assetHelper.withCleaner(wsk.rule, ruleName) {
+                (rule, name) => wsk.cli(wp.overrides ++ Seq("rule", "create", "--auth", wp.authKey, name, triggerName, actionName, "--enable"), verbose = true)
+            }.stdout
+            stdout should include regex (s"""PUT https://.*/rules/$ruleName""")
+            stdout should include regex (s"""POST https://.*/rules/$ruleName""")
+            stdout should include regex (s"""ok: rule $ruleName is (active|activating)""")
+    }
+
+    it should "list rules filtered by trigger and action" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val triggers = Seq("filterRulesTrigger1", "filterRulesTrigger2")
+            val actions = Seq("filterRulesAction1", "filterRulesAction2")
+            val rules = Seq(
+                ("filterRules11", triggers(0), actions(0)),
+                ("filterRules12", triggers(0), actions(1)),
+                ("filterRules21", triggers(1), actions(0)))
+            triggers foreach { t => assetHelper.withCleaner(wsk.trigger, t) { (trigger, name) => trigger.create(name) } }
+            actions foreach { a => assetHelper.withCleaner(wsk.action, a) { (action, name) => action.create(name, defaultAction) } }
+            rules foreach {
+                case (r, t, a) => assetHelper.withCleaner(wsk.rule, r) { (rule, name) => rule.create(name, trigger = t, action = a) }
+            }
+
+            def listed(filters: String*) = {
+                val stdout = wsk.cli(wp.overrides ++ Seq("rule", "list", "--auth", wp.authKey) ++ filters).stdout
+                rules map { _._1 } filter { stdout.contains(_) }
+            }
+
+            listed("--trigger", triggers(0)) shouldBe Seq("filterRules11", "filterRules12")
+            listed("--action", actions(0)) shouldBe Seq("filterRules11", "filterRules21")
+            listed("--trigger", triggers(0), "--action", actions(0)) shouldBe Seq("filterRules11")
+    }
+
+    it should "fire a trigger with --require-rule only if an active rule connects it" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val triggerName = "requireRuleTrigger"
+            val actionName = "requireRuleAction"
+            val ruleName = "requireRuleRule"
+            assetHelper.withCleaner(wsk.trigger, triggerName) {
+                (trigger, name) => trigger.create(name)
+            }
+            assetHelper.withCleaner(wsk.action, actionName) {
+                (action, name) => action.create(name, defaultAction)
+            }
+            val fire = wp.overrides ++ Seq("trigger", "fire", "--auth", wp.authKey, triggerName, "--require-rule")
+            wsk.cli(fire, expectedExitCode = MISUSE_EXIT).
+                stdout should include("has no active rule")
+
+            assetHelper.withCleaner(wsk.rule, ruleName) {
+                (rule, name) => rule.create(name, trigger = triggerName, action = actionName, enable = true)
+            }
+            wsk.cli(fire).stdout should include("ok: triggered")
+    }
+
+    it should "fire a trigger repeatedly with an interval between fires" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "repeatFireTrigger"
+            assetHelper.withCleaner(wsk.trigger, name) {
+                (trigger, _) => trigger.create(name)
+            }
+            val start = System.currentTimeMillis
+            val stdout = wsk.cli(wp.overrides ++ Seq("trigger", "fire", "--auth", wp.authKey, name, "--repeat", "3", "--interval", "1000")).stdout
+            val elapsed = System.currentTimeMillis - start
+            "ok: triggered".r.findAllIn(stdout).length shouldBe 3
+            stdout should include(s"ok: fired $name 3 times")
+            elapsed should be >= 2000L
+
+            wsk.cli(wp.overrides ++ Seq("trigger", "fire", "--auth", wp.authKey, name, "--repeat", "0"), expectedExitCode = MISUSE_EXIT).
+                stdout should include("--repeat must be at least 1")
+    }
+
+    it should "fire on a new connection when the host has closed the idle one" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "idleCloseTrigger"
+            assetHelper.withCleaner(wsk.trigger, name) {
+                (trigger, _) => trigger.create(name)
+            }
+            val (proxy, accepted) = idleClosingProxy(wp.apihost, idleMillis = 1000)
+            try {
+                // the proxy closes the connection between the two fires
+                val apihost = s"localhost:${proxy.getLocalPort}"
+                wsk.cli(wp.overrides ++ Seq("--apihost", apihost, "trigger", "fire", "--auth", wp.authKey, name, "--repeat", "2", "--interval", "3000")).
+                    stdout should include(s"ok: fired $name 2 times")
+                accepted.get shouldBe 2
+            } finally {
+                proxy.close()
+            }
+    }
+
+    it should "reject a payload that is a JSON array and pass a scalar payload with its type" in withAssetCleaner(wskprops) {
+        (wp, assetHelper) =>
+            val name = "payloadFireTrigger"
+            assetHelper.withCleaner(wsk.trigger, name) {
+                (trigger, _) => trigger.create(name)
+            }
+            def fire(payload: String, expectedExitCode: Int = SUCCESS_EXIT) = wsk.cli(wp.overrides ++
+                Seq("trigger", "fire", "--auth", wp.authKey, name, payload), expectedExitCode, verbose = true).stdout
+
+            fire("[1, 2]", MISUSE_EXIT) should include("error: the payload is a JSON array; it must be a JSON object")
+            fire("42") should include(""""payload": 42""")
+            fire("some text") should include(""""payload": "some text"""")
     }
 
     behavior of "Wsk Namespace CLI"
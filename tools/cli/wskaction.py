@@ -22,8 +22,38 @@ import argparse
 import urllib
 import re
 import subprocess
+import sys
+import time
+import threading
+import Queue
+import tarfile
+import StringIO
+import zlib
+from datetime import datetime
 from wskitem import Item
-from wskutil import addAuthenticatedCommand, bold, request, getParams, getActivationArgument, getAnnotations, responseError, parseQName, getQName, apiBase, getPrettyJson
+from wskrule import Rule
+from wskutil import addAuthenticatedCommand, bold, dict2obj, request, getParams, getActivationArgument, getAnnotations, mergeKeyValues, redactSecrets, responseError, parseQName, getQName, apiBase, getPrettyJson, printPrettyJson
+
+# how many times and how many seconds apart to poll for the activation of a
+# blocking invoke that failed at the gateway
+ACTIVATION_POLL_RETRIES = 10
+ACTIVATION_POLL_SECONDS = 2
+
+# the most invokes that --repeat issues at the same time
+MAX_INVOKE_CONCURRENCY = 10
+
+# the largest invoke payload in bytes the platform accepts by default
+MAX_INVOKE_PAYLOAD = 1024 * 1024
+
+# the reserved payload key under which --meta values are passed to web actions
+INVOKE_META_KEY = '__ow_meta'
+
+# parses a --meta key=value pair
+def metaValue(s):
+    key, sep, value = s.partition('=')
+    if not sep or not key:
+        raise argparse.ArgumentTypeError('%s is not of the form key=value' % s)
+    return (key, value)
 
 #
 # 'wsk actions' CLI
@@ -38,13 +68,21 @@ class Action(Item):
         subcmd.add_argument('name', help='the name of the action')
         subcmd.add_argument('artifact', help='artifact (e.g., file name) containing action definition')
         addAuthenticatedCommand(subcmd, props)
-        subcmd.add_argument('--docker', help='treat artifact as docker image path on dockerhub', action='store_true')
-        subcmd.add_argument('--copy', help='treat artifact as the name of an existing action', action='store_true')
-        subcmd.add_argument('--sequence', help='treat artifact as comma separated sequence of actions to invoke', action='store_true')
-        subcmd.add_argument('--lib', help='add library to artifact (must be a gzipped tar file)', type=argparse.FileType('r'))
-        subcmd.add_argument('--shared', nargs='?', const='yes', choices=['yes', 'no'], help='shared action (default: private)')
+        self.addUpsertArgument(subcmd)
+        # the artifact is a file unless one of these says otherwise
+        kind = subcmd.add_mutually_exclusive_group()
+        kind.add_argument('--docker', help='treat artifact as docker image path on dockerhub', action='store_true')
+        kind.add_argument('--copy', help='treat artifact as the name of an existing action', action='store_true')
+        kind.add_argument('--sequence', help='treat artifact as comma separated sequence of actions to invoke', action='store_true')
+        subcmd.add_argument('--exec-only', help='when copying an action, copy only its code and not its parameters, annotations or limits', action='store_true')
+        subcmd.add_argument('--strict-namespace', help='fail if the action name is in a namespace other than the default namespace', action='store_true')
+        subcmd.add_argument('--lib', help='add library to artifact (must be a tar file, which may be gzipped)', type=argparse.FileType('rb'))
+        subcmd.add_argument('--conductor', nargs='?', const='true', type=str.lower, choices=['true', 'false'], help='annotate the action as a conductor action that composes other actions')
+        self.addSharedArgument(subcmd)
         subcmd.add_argument('-a', '--annotation', help='annotations', nargs=2, action='append')
+        subcmd.add_argument('--annotation-file', help='file containing a JSON object of annotations; -a takes precedence', metavar='file')
         subcmd.add_argument('-p', '--param', help='default parameters', nargs=2, action='append')
+        self.addStrictKeysArgument(subcmd)
         subcmd.add_argument('-t', '--timeout', help='the timeout limit in milliseconds when the action will be terminated', type=int)
         subcmd.add_argument('-m', '--memory', help='the memory limit in MB of the container that runs the action', type=int)
 
@@ -52,33 +90,118 @@ class Action(Item):
         subcmd.add_argument('name', help='the name of the action')
         subcmd.add_argument('artifact', nargs='?', default=None, help='artifact (e.g., file name) containing action definition')
         addAuthenticatedCommand(subcmd, props)
-        subcmd.add_argument('--docker', help='treat artifact as docker image path on dockerhub', action='store_true')
-        subcmd.add_argument('--copy', help='treat artifact as the name of an existing action', action='store_true')
-        subcmd.add_argument('--sequence', help='treat artifact as comma separated sequence of actions to invoke', action='store_true')
-        subcmd.add_argument('--lib', help='add library to artifact (must be a gzipped tar file)', type=argparse.FileType('r'))
-        subcmd.add_argument('--shared', nargs='?', const='yes', choices=['yes', 'no'], help='shared action (default: private)')
+        subcmd.add_argument('--must-exist', help='fail rather than create the action if it does not exist', action='store_true')
+        # the artifact is a file unless one of these says otherwise
+        kind = subcmd.add_mutually_exclusive_group()
+        kind.add_argument('--docker', help='treat artifact as docker image path on dockerhub', action='store_true')
+        kind.add_argument('--copy', help='treat artifact as the name of an existing action', action='store_true')
+        kind.add_argument('--sequence', help='treat artifact as comma separated sequence of actions to invoke', action='store_true')
+        subcmd.add_argument('--exec-only', help='when copying an action, copy only its code and not its parameters, annotations or limits', action='store_true')
+        subcmd.add_argument('--strict-namespace', help='fail if the action name is in a namespace other than the default namespace', action='store_true')
+        subcmd.add_argument('--lib', help='add library to artifact (must be a tar file, which may be gzipped)', type=argparse.FileType('rb'))
+        subcmd.add_argument('--conductor', nargs='?', const='true', type=str.lower, choices=['true', 'false'], help='annotate the action as a conductor action that composes other actions')
+        self.addSharedArgument(subcmd)
         subcmd.add_argument('-a', '--annotation', help='annotations', nargs=2, action='append')
+        subcmd.add_argument('--annotation-file', help='file containing a JSON object of annotations; -a takes precedence', metavar='file')
         subcmd.add_argument('-p', '--param', help='default parameters', nargs=2, action='append')
+        self.addStrictKeysArgument(subcmd)
+        subcmd.add_argument('--merge', help='add the parameters and annotations to those of the action rather than replace them', action='store_true')
+        subcmd.add_argument('--del-param', help='remove this parameter from those of the action; implies --merge', action='append', metavar='key')
+        subcmd.add_argument('--del-annotation', help='remove this annotation from those of the action; implies --merge', action='append', metavar='key')
+        subcmd.add_argument('--ignore-missing', help='do not fail if a parameter or annotation to remove does not exist', action='store_true')
         subcmd.add_argument('-t', '--timeout', help='the timeout limit in milliseconds when the action will be terminated', type=int)
         subcmd.add_argument('-m', '--memory', help='the memory limit in MB of the container that runs the action', type=int)
 
         subcmd = parser.add_parser('invoke', help='invoke action')
         subcmd.add_argument('name', help='the name of the action to invoke')
+        subcmd.add_argument('payload', help='the payload to pass to the action, a JSON object whose fields are added to the parameters', nargs='?')
         addAuthenticatedCommand(subcmd, props)
         subcmd.add_argument('-p', '--param', help='parameters', nargs=2, action='append')
         subcmd.add_argument('-b', '--blocking', action='store_true', help='blocking invoke')
         subcmd.add_argument('-r', '--result', help='show only activation result if a blocking activation (unless there is a failure)', action='store_true')
+        subcmd.add_argument('--show-secrets', help='do not mask secrets when showing the payload in verbose mode', action='store_true')
+        subcmd.add_argument('--show-defaults', help='show the default parameters of the action and those this invoke overrides', action='store_true')
+        subcmd.add_argument('--repeat', help='invoke the action this many times without blocking', type=int, metavar='N')
+        subcmd.add_argument('--concurrency', help='with --repeat, how many invokes to issue at the same time (at most %s)' % MAX_INVOKE_CONCURRENCY, type=int, default=1)
+        subcmd.add_argument('--meta', help='request metadata for a web action, passed under %s and not as a parameter' % INVOKE_META_KEY, type=metaValue, action='append', metavar='KEY=VALUE')
+        subcmd.add_argument('--save-activation-id', help='write the activation id to this file; with --repeat, append the ids to it', metavar='file')
+        subcmd.add_argument('--max-payload', help='the largest payload in bytes to send (default: %s)' % MAX_INVOKE_PAYLOAD, type=int, default=MAX_INVOKE_PAYLOAD, metavar='BYTES')
+
+        subcmd = parser.add_parser('get', help='get action')
+        subcmd.add_argument('name', help='the name of the action')
+        subcmd.add_argument('project', nargs='?', help='project only this property')
+        addAuthenticatedCommand(subcmd, props)
+        subcmd.add_argument('-s', '--summary', help='summarize entity details', action='store_true')
+        view = subcmd.add_mutually_exclusive_group()
+        view.add_argument('--code', help='print only the action code', action='store_true')
+        view.add_argument('--url', help='print only the URL of a web action', action='store_true')
+        view.add_argument('--resolve', help='show the parameters of the package, and the package a binding refers to, that make up the action parameters', action='store_true')
+        self.addRawArgument(view)
+
+        subcmd = parser.add_parser('list', help='list all %s' % self.collection)
+        subcmd.add_argument('name', nargs='?', help='the namespace to list')
+        addAuthenticatedCommand(subcmd, props)
+        subcmd.add_argument('-s', '--skip', help='skip this many entities from the head of the collection', type=int, default=0)
+        subcmd.add_argument('-l', '--limit', help='only return this many entities from the collection', type=int, default=30)
+        subcmd.add_argument('--shared', help='list only shared actions', action='store_true')
+        subcmd.add_argument('--name', dest='name_prefix', metavar='PREFIX', help='list only actions whose name starts with this prefix')
+        subcmd.add_argument('--by-package', help='group the actions under the package they are in', action='store_true')
+        self.addFullArgument(subcmd)
+        self.addShowVersionArgument(subcmd)
+        self.addCountArgument(subcmd)
 
-        self.addDefaultCommands(parser, props)
+        subcmd = parser.add_parser('delete', help='delete %s' % self.name)
+        subcmd.add_argument('name', help='the name of the %s' % self.name)
+        addAuthenticatedCommand(subcmd, props)
+        subcmd.add_argument('--cascade', help='also delete the rules that fire the action, disabling them first; this fetches every rule in the namespace', action='store_true')
 
     def cmd(self, args, props):
         if args.subcmd == 'invoke':
             return self.invoke(args, props)
+        elif args.subcmd == 'get' and args.code:
+            return self.getCode(args, props)
+        elif args.subcmd == 'get' and args.url:
+            return self.getUrl(args, props)
+        elif args.subcmd == 'get' and args.resolve:
+            return self.getResolved(args, props)
         else:
             return super(Action, self).cmd(args, props)
 
     def create(self, args, props, update):
-        exe = self.getExec(args, props)
+        if args.conductor is not None:
+            # the same as -a conductor true|false, so it counts as a duplicate of one
+            args.annotation = (args.annotation or []) + [ [ 'conductor', args.conductor ] ]
+        if not self.removeDuplicateKeys(args):
+            return 2
+        if args.strict_namespace:
+            self.checkNamespace(args.name, props)
+        if args.artifact is not None and os.path.isdir(args.artifact) and not (args.docker or args.copy or args.sequence):
+            # an action runs a single file, and the runtimes do not take an
+            # archive of a directory; without this an update would silently
+            # leave the code as it was
+            print 'error: the artifact %s is a directory; give the file with the action code' % args.artifact
+            return 2
+        if args.artifact is not None and os.path.isfile(args.artifact) and not (args.docker or args.copy or args.sequence):
+            if self.isEmptyArtifact(args.artifact):
+                print 'error: the artifact %s is empty; give the file with the action code' % args.artifact
+                return 2
+        if update and args.must_exist:
+            res = self.httpGet(args, props)
+            if res.status == httplib.NOT_FOUND:
+                print 'error: action %(name)s does not exist; use "wsk action create" to create it' % {'name': args.name }
+                return res.status
+            elif res.status != httplib.OK:
+                return responseError(res)
+        source = None
+        if args.copy:
+            # the source may be in another namespace, e.g., /otherns/action,
+            # and is read with the same key used to create the copy
+            res = self.httpGet(args, props, args.artifact)
+            if res.status != httplib.OK:
+                print 'error: cannot read action %(source)s to copy:' % {'source': args.artifact },
+                return responseError(res, None)
+            source = json.loads(res.read())
+        exe = self.getExec(args, props, source)
         if args.sequence:
             if args.param is None:
                 args.param = []
@@ -90,36 +213,95 @@ class Action(Item):
         validExe = exe is not None and 'kind' in exe
         if update or validExe: # if create action, then exe must be valid
             payload = {}
-            if args.annotation:
-                payload['annotations'] = getAnnotations(args)
-            if args.param:
-                payload['parameters'] = getParams(args)
-            # API will accept limits == {} as limits not specified on an update
-            if args.timeout or args.memory:
-                payload['limits'] = self.getLimits(args)
+            if source is not None and not args.exec_only:
+                # a copy inherits the source parameters, annotations and limits
+                # unless they are overridden on the command line
+                payload['annotations'] = mergeKeyValues(source['annotations'], getAnnotations(args))
+                payload['parameters'] = mergeKeyValues(source['parameters'], getParams(args))
+                limits = source['limits'].copy() if 'limits' in source else {}
+                limits.update(self.getLimits(args))
+                payload['limits'] = limits
+            elif update and (args.merge or args.del_param or args.del_annotation):
+                code = self.mergeStoredKeyValues(args, props, payload)
+                if code != 0:
+                    return code
+                limits = self.getLimits(args)
+                if limits:
+                    payload['limits'] = limits
+            else:
+                if args.annotation or args.annotation_file:
+                    payload['annotations'] = getAnnotations(args)
+                if args.param:
+                    payload['parameters'] = getParams(args)
+                # API will accept limits == {} as limits not specified on an update
+                limits = self.getLimits(args)
+                if limits:
+                    payload['limits'] = limits
             if validExe:
                 payload['exec'] = exe
             if args.shared:
                 self.addPublish(payload, args)
             return self.put(args, props, update, json.dumps(payload))
         else:
-            if not args.copy:
-                print 'the artifact "%s" is not a valid file. If this is a docker image, use --docker.' % args.artifact
-            else:
-                print 'the action "%s" does not exit (or your are not entitled to it).' % args.artifact
+            print 'the artifact "%s" is not a valid file. If this is a docker image, use --docker.' % args.artifact
             return 2
 
+    # sets the payload parameters and annotations to those stored for the
+    # action, less those named by --del-param and --del-annotation, with those
+    # given on the command line added; returns 0 or an exit code on failure
+    def mergeStoredKeyValues(self, args, props, payload):
+        res = self.httpGet(args, props)
+        if res.status != httplib.OK:
+            return responseError(res)
+        action = json.loads(res.read())
+        for kind, field, removed, given in [
+                ('parameter', 'parameters', args.del_param or [], getParams(args)),
+                ('annotation', 'annotations', args.del_annotation or [], getAnnotations(args)) ]:
+            stored = action.get(field, [])
+            missing = [ key for key in removed if key not in [ s['key'] for s in stored ] ]
+            if missing and not args.ignore_missing:
+                print 'error: action %(name)s has no %(kind)s %(keys)s to remove' % {'name': args.name, 'kind': kind, 'keys': ', '.join(missing) }
+                return 2
+            payload[field] = mergeKeyValues([ s for s in stored if s['key'] not in removed ], given)
+        return 0
+
     def invoke(self, args, props):
+        size = len(json.dumps(self.getInvokeArgument(args)))
+        if size > args.max_payload:
+            print 'error: the payload is %(size)s bytes, more than the %(max)s bytes an invoke may send; use --max-payload if the deployment accepts larger payloads' % {'size': size, 'max': args.max_payload }
+            return 2
+        idFile = self.openActivationIdFile(args)
+        if args.repeat is not None:
+            return self.invokeRepeatedly(args, props, idFile)
+        if args.show_defaults:
+            self.showDefaults(args, props)
         res = self.doInvoke(args, props)
+        if args.blocking and res.status in [httplib.BAD_GATEWAY, httplib.GATEWAY_TIMEOUT]:
+            res = self.pollForActivation(args, props, res)
+        if args.blocking and args.result:
+            activation = self.getActivationFromResponse(res)
+            if activation is not None:
+                self.saveActivationId(idFile, activation['activationId'])
+                if args.verbose:
+                    self.printActivationTiming(activation)
+                return self.printActivationResult(activation, res.status)
         # OK implies successful blocking invoke
-        # ACCEPTED implies non-blocking
+        # ACCEPTED implies non-blocking, or a blocking invoke that timed out
         # All else are failures
-        if res.status == httplib.OK or res.status == httplib.ACCEPTED:
+        if res.status == httplib.ACCEPTED and args.blocking:
             result = json.loads(res.read())
+            self.saveActivationId(idFile, result['activationId'])
+            print 'error: blocking invoke of %(name)s timed out; activation id is %(id)s, use "wsk activation get %(id)s" to get the activation when it completes' % {'name': args.name, 'id': result['activationId'] }
+            return res.status
+        elif res.status == httplib.OK or res.status == httplib.ACCEPTED:
+            result = json.loads(res.read())
+            self.saveActivationId(idFile, result['activationId'])
             if not (args.result and args.blocking and res.status == httplib.OK):
                 print 'ok: invoked %(name)s with id %(id)s' % {'name': args.name, 'id': result['activationId'] }
+            if res.status == httplib.OK and args.verbose:
+                self.printActivationTiming(result)
             if res.status == httplib.OK and args.result:
-                print getPrettyJson(result['response']['result'])
+                printPrettyJson(result['response']['result'])
             elif res.status == httplib.OK :
                 print bold('response:')
                 print getPrettyJson(result['response'])
@@ -127,6 +309,300 @@ class Action(Item):
         else:
             return responseError(res)
 
+    # opens the --save-activation-id file, creating its directory if needed,
+    # before invoking so that an unwritable file does not go unnoticed until
+    # after the action runs; the file is appended to with --repeat
+    def openActivationIdFile(self, args):
+        if not args.save_activation_id:
+            return None
+        try:
+            directory = os.path.dirname(os.path.abspath(args.save_activation_id))
+            if not os.path.isdir(directory):
+                os.makedirs(directory)
+            return open(args.save_activation_id, 'a' if args.repeat is not None else 'w')
+        except (IOError, OSError) as e:
+            print 'error: cannot write activation ids to %s: %s' % (args.save_activation_id, e.strerror)
+            sys.exit(2)
+
+    def saveActivationId(self, idFile, activationId):
+        if idFile is not None:
+            idFile.write('%s\n' % activationId)
+            idFile.flush()
+
+    # invokes the action args.repeat times without blocking, up to
+    # args.concurrency at a time, then prints the activation ids and the
+    # invokes that failed; returns the status of the first failed invoke
+    def invokeRepeatedly(self, args, props, idFile = None):
+        if args.blocking:
+            print 'error: --repeat invokes without blocking and cannot be used with --blocking'
+            return 2
+        if args.repeat < 1 or args.concurrency < 1:
+            print 'error: --repeat and --concurrency must be at least 1'
+            return 2
+
+        pending = Queue.Queue()
+        for i in range(args.repeat):
+            pending.put(i)
+        results = [ None ] * args.repeat
+
+        def invokeNext():
+            while True:
+                try:
+                    i = pending.get_nowait()
+                except Queue.Empty:
+                    return
+                res = self.doInvoke(args, props)
+                try:
+                    result = json.loads(res.read())
+                except:
+                    result = { 'error': res.get('error', 'unrecognized failure') if isinstance(res, dict) else 'unrecognized failure' }
+                results[i] = (res.status, result)
+
+        workers = [ threading.Thread(target=invokeNext) for _ in range(min(args.concurrency, MAX_INVOKE_CONCURRENCY, args.repeat)) ]
+        for w in workers:
+            # daemon threads do not hold up the exit on ctrl-c
+            w.daemon = True
+            w.start()
+        for w in workers:
+            # a join without a timeout cannot be interrupted by ctrl-c
+            while w.is_alive():
+                w.join(1)
+
+        failures = [ (i, status, result) for i, (status, result) in enumerate(results) if status != httplib.ACCEPTED ]
+        for status, result in results:
+            if status == httplib.ACCEPTED:
+                self.saveActivationId(idFile, result['activationId'])
+                print 'ok: invoked %(name)s with id %(id)s' % {'name': args.name, 'id': result['activationId'] }
+        for i, status, result in failures:
+            print 'error: invoke %(n)s of %(name)s failed: %(error)s' % {'n': i + 1, 'name': args.name, 'error': result.get('error', getPrettyJson(result)) }
+
+        if failures:
+            print 'error: %(failed)s of %(total)s invokes failed' % {'failed': len(failures), 'total': args.repeat }
+            return failures[0][1]
+        else:
+            print 'ok: %(total)s invokes succeeded' % {'total': args.repeat }
+            return 0
+
+    # returns the activation record in the response to a blocking invoke, or
+    # None if the response does not carry one (e.g., the invoke timed out)
+    def getActivationFromResponse(self, res):
+        try:
+            result = json.loads(res.read())
+        except:
+            return None
+        return result if isinstance(result, dict) and 'response' in result else None
+
+    # prints how long a completed activation took and how it ended
+    def printActivationTiming(self, activation):
+        start, end = activation.get('start'), activation.get('end')
+        if start is None or end is None:
+            return
+        print 'activation %(id)s: %(status)s, duration %(duration)s ms (start %(start)s, end %(end)s)' % {
+            'id': activation['activationId'],
+            'status': activation['response'].get('status'),
+            'duration': end - start,
+            'start': datetime.fromtimestamp(start / 1000.0),
+            'end': datetime.fromtimestamp(end / 1000.0)
+        }
+
+    # prints the result of a completed activation: a successful result goes to
+    # stdout, and the result of a failed activation goes to stderr with a
+    # failing exit code so that scripts can tell the two apart
+    def printActivationResult(self, activation, status):
+        result = activation['response'].get('result', {})
+        if activation['response'].get('success'):
+            printPrettyJson(result)
+            return 0
+        else:
+            printPrettyJson(result, sys.stderr)
+            return status if status != httplib.OK else httplib.BAD_GATEWAY
+
+    # a blocking invoke may fail at a gateway while the activation still runs to
+    # completion; if the failed response carries the activation id, poll for
+    # the activation record and return it in place of the failed response
+    def pollForActivation(self, args, props, res):
+        try:
+            result = json.loads(res.read())
+        except:
+            return res
+        if not isinstance(result, dict) or 'activationId' not in result or 'response' in result:
+            return res
+
+        url = 'https://%(apibase)s/namespaces/_/activations/%(id)s' % {
+            'apibase': apiBase(props),
+            'id': urllib.quote(result['activationId'], '')
+        }
+        for _ in range(ACTIVATION_POLL_RETRIES):
+            time.sleep(ACTIVATION_POLL_SECONDS)
+            activationRes = request('GET', url, auth=args.auth, verbose=args.verbose)
+            if activationRes.status == httplib.OK:
+                activation = json.loads(activationRes.read())
+                if not activation['response'].get('success'):
+                    # report a failed activation as the controller would have
+                    activationRes.status = res.status
+                return activationRes
+        return res
+
+    # shows where the parameters of an action in a package come from: the
+    # action parameters are those of the package a binding refers to, then
+    # those of the binding, then those of the action itself, each superseding
+    # the last. The API already merges them; this only makes the layers visible.
+    def getResolved(self, args, props):
+        namespace, pname = parseQName(args.name, props)
+        res = self.httpGet(args, props)
+        if res.status != httplib.OK:
+            return responseError(res)
+        action = json.loads(res.read())
+        resolved = { 'parameters': action['parameters'] }
+
+        if '/' in pname:
+            pkgName = getQName(pname.rsplit('/', 1)[0], namespace)
+            res = self.getPackage(args, props, pkgName)
+            if res.status != httplib.OK:
+                return responseError(res)
+            pkg = json.loads(res.read())
+            binding = pkg.get('binding')
+            if binding:
+                sourceName = getQName(binding['name'], binding['namespace'])
+                res = self.getPackage(args, props, sourceName)
+                if res.status != httplib.OK:
+                    return responseError(res)
+                resolved['binding'] = pkgName
+                resolved['bindingParameters'] = pkg['parameters']
+                resolved['package'] = sourceName
+                resolved['packageParameters'] = json.loads(res.read())['parameters']
+            else:
+                resolved['package'] = pkgName
+                resolved['packageParameters'] = pkg['parameters']
+
+        print 'ok: got action %(name)s, resolving parameters' % {'name': args.name }
+        print getPrettyJson(resolved)
+        return 0
+
+    # with --by-package, prints the actions under a header for each package,
+    # in order of package name, with those in no package first under (default)
+    def printList(self, args, entities):
+        if not args.by_package:
+            return super(Action, self).printList(args, entities)
+        packages = {}
+        for e in entities:
+            # /namespace/package/action or /namespace/action
+            parts = getQName(e['name'], e['namespace']).split('/')
+            packages.setdefault(parts[2] if len(parts) > 3 else None, []).append(e)
+        for pkg in sorted(packages.keys(), key=lambda p: (p is not None, p)):
+            print bold(pkg if pkg is not None else '(default)')
+            super(Action, self).printList(args, packages[pkg])
+
+    def delete(self, args, props):
+        code = super(Action, self).delete(args, props)
+        if code == 0 and args.cascade:
+            return self.deleteRules(args, props)
+        return code
+
+    # deletes the rules in the namespace of the action that fire it, which
+    # would otherwise be left referring to an action that does not exist
+    def deleteRules(self, args, props):
+        namespace, pname = parseQName(args.name, props)
+        res, rules = Rule().getAllRules(args, props, namespace)
+        if rules is None:
+            print 'error: deleted action %(name)s but cannot list the rules that fire it:' % {'name': args.name },
+            return responseError(res, None)
+        for rule in [ r for r in rules if r['action'] == pname ]:
+            ruleArgs = dict2obj({
+                'name': getQName(rule['name'], rule['namespace']),
+                'disable': rule['status'] != 'inactive',
+                'auth': args.auth,
+                'verbose': args.verbose
+            })
+            code = Rule().delete(ruleArgs, props)
+            if code != 0:
+                return code
+        return 0
+
+    # lists the actions of a sequence in the order they run
+    def getEntityNotes(self, entity):
+        components = self.getSequenceComponents(entity)
+        return [ 'sequence: %s' % ' -> '.join(components) ] if components else []
+
+    def getEntitySummary(self, entity):
+        summary = super(Action, self).getEntitySummary(entity)
+        components = self.getSequenceComponents(entity)
+        if components:
+            summary += '\n   (%s: %s)' % (bold('sequence'), ' -> '.join(components))
+        return summary
+
+    # returns the names of the actions of a sequence, which a sequence keeps
+    # in its _actions parameter, or None if the action is not a sequence
+    def getSequenceComponents(self, entity):
+        actions = [ p['value'] for p in entity.get('parameters', []) if p['key'] == '_actions' ]
+        if not actions:
+            return None
+        components = actions[0]
+        if isinstance(components, basestring):
+            try:
+                components = json.loads(components)
+            except ValueError:
+                return None
+        return components if isinstance(components, list) else None
+
+    # returns the HTTP response of getting a package by its qualified name
+    def getPackage(self, args, props, qname):
+        namespace, pname = parseQName(qname, props)
+        url = 'https://%(apibase)s/namespaces/%(namespace)s/packages/%(name)s' % {
+            'apibase': apiBase(props),
+            'namespace': urllib.quote(namespace),
+            'name': self.getSafeName(pname)
+        }
+        return request('GET', url, auth=args.auth, verbose=args.verbose)
+
+    # prints only the code of an action so that it may be redirected to a file
+    def getCode(self, args, props):
+        res = self.httpGet(args, props)
+        if res.status == httplib.OK:
+            exe = json.loads(res.read())['exec']
+            if 'code' in exe:
+                sys.stdout.write(exe['code'])
+                return 0
+            else:
+                print >> sys.stderr, 'error: the code for %(kind)s action %(name)s is not text; use "wsk action get %(name)s exec" instead' % {'kind': exe['kind'], 'name': args.name }
+                return 2
+        else:
+            return responseError(res)
+
+    # prints the URL of a web action, i.e., one with a web-export annotation:
+    # https://<apihost>/api/<version>/web/<namespace>/<package>/<action>, where
+    # an action that is not in a package is in the package named default
+    def getUrl(self, args, props):
+        res = self.httpGet(args, props)
+        if res.status == httplib.OK:
+            action = json.loads(res.read())
+            annotations = dict([ (a['key'], a['value']) for a in action.get('annotations', []) ])
+            if annotations.get('web-export') not in [True, 'true']:
+                print >> sys.stderr, 'error: action %(name)s is not a web action; update it with "-a web-export true" to make it one' % {'name': args.name }
+                return 2
+            path = action['namespace'].split('/') + action['name'].split('/')
+            if len(path) == 2:
+                path.insert(1, 'default')
+            print 'https://%(apibase)s/web/%(path)s' % {
+                'apibase': apiBase(props),
+                'path': '/'.join([ urllib.quote(p, '@') for p in path ])
+            }
+            return 0
+        else:
+            return responseError(res)
+
+    # prints to stderr the names of the default parameters of the action and
+    # which of them the invoke parameters override; values are not shown since
+    # defaults often hold credentials. This does not change the invoke payload.
+    def showDefaults(self, args, props):
+        action = self.getAction(args, props, args.name)
+        if action is None:
+            return
+        defaults = [ p['key'] for p in action['parameters'] ]
+        overridden = [ k for k in defaults if k in getActivationArgument(args) ]
+        print >> sys.stderr, 'default parameters: %s' % (', '.join(defaults) if defaults else 'none')
+        print >> sys.stderr, 'overridden by invoke: %s' % (', '.join(overridden) if overridden else 'none')
+
     # invokes the action and returns HTTP response
     def doInvoke(self, args, props):
         namespace, pname = parseQName(args.name, props)
@@ -136,36 +612,65 @@ class Action(Item):
             'name': self.getSafeName(pname),
             'blocking': 'true' if args.blocking else 'false'
         }
-        payload = json.dumps(getActivationArgument(args))
+        argument = self.getInvokeArgument(args)
+        payload = json.dumps(argument)
+        loggedPayload = None
+        if args.verbose:
+            shown = argument if 'show_secrets' in args and args.show_secrets else redactSecrets(argument)
+            loggedPayload = json.dumps(shown)
+            print >> sys.stderr, 'Payload:'
+            print >> sys.stderr, getPrettyJson(shown)
         headers = {
             'Content-Type': 'application/json'
         }
-        res = request('POST', url, payload, headers, auth=args.auth, verbose=args.verbose)
+        res = request('POST', url, payload, headers, auth=args.auth, verbose=args.verbose, loggedBody=loggedPayload)
         return res
 
-    # creates { timeout: msecs, memory: megabytes } action timeout/memory limits
+    # returns the invoke payload: the parameters, and any --meta values
+    # under a reserved key which only a web action is expected to read
+    def getInvokeArgument(self, args):
+        argument = getActivationArgument(args)
+        if 'meta' in args and args.meta:
+            argument[INVOKE_META_KEY] = dict(args.meta)
+        return argument
+
+    # creates { timeout: msecs, memory: megabytes } action timeout/memory limits;
+    # a limit that is not given with -t or -m is taken from a timeout or memory
+    # annotation if there is one
     def getLimits(self, args):
+        annotations = dict([ (a['key'], a['value']) for a in getAnnotations(args) ])
         limits = {}
-        if args.timeout:
-            limits['timeout'] = args.timeout
-        if args.memory :
-            limits['memory'] = args.memory
+        for limit, value in [ ('timeout', args.timeout), ('memory', args.memory) ]:
+            if value:
+                limits[limit] = value
+            elif limit in annotations:
+                try:
+                    limits[limit] = int(annotations[limit])
+                except (TypeError, ValueError):
+                    print 'error: the %(limit)s annotation must be an integer, not %(value)s' % {'limit': limit, 'value': json.dumps(annotations[limit]) }
+                    sys.exit(2)
         return limits
 
+    # an action created from an empty file (or one with only whitespace for
+    # code that is not in a jar) would only fail when it is invoked
+    def isEmptyArtifact(self, artifact):
+        contents = open(artifact, 'rb').read()
+        return contents == '' if artifact.endswith('.jar') else contents.strip() == ''
+
     # creates one of:
     # { kind: "nodejs", code: "js code", initializer: "base64 encoded string" }
     #   where initializer is optional, or:
     # { kind: "blackbox", image: "docker image" }, or:
     # { kind: "swift", code: "swift code" }, or:
     # { kind: "java", jar: "base64-encoded JAR", main: "FQN of main class" }
-    def getExec(self, args, props):
+    # when copying, source is the existing action to take the exec from.
+    def getExec(self, args, props, source = None):
         exe = {}
         if args.docker:
             exe['kind'] = 'blackbox'
             exe['image'] = args.artifact
         elif args.copy:
-            existingAction = args.artifact
-            exe = self.getActionExec(args, props, existingAction)
+            exe = source['exec'] if source is not None else None
         elif args.sequence:
             pipeAction = '/whisk.system/system/pipe'
             exe = self.getActionExec(args, props, pipeAction)
@@ -182,9 +687,29 @@ class Action(Item):
                 exe['kind'] = 'nodejs'
                 exe['code'] = contents
         if args.lib:
-            exe['initializer'] = base64.b64encode(args.lib.read())
+            exe['initializer'] = base64.b64encode(self.getLibrary(args.lib))
         return exe
 
+    # reads a library for --lib, which is a tar archive that may be gzipped;
+    # the archive is opened as its extension suggests (.tar, .tgz, .tar.gz or
+    # .gz) or as either kind otherwise, so that an archive that cannot be read
+    # is rejected here rather than when the action is initialized
+    def getLibrary(self, lib):
+        contents = lib.read()
+        name = lib.name.lower()
+        if name.endswith('.tgz') or name.endswith('.gz'):
+            mode = 'r:gz'
+        elif name.endswith('.tar'):
+            mode = 'r:'
+        else:
+            mode = 'r:*'
+        try:
+            tarfile.open(fileobj=StringIO.StringIO(contents), mode=mode).getmembers()
+        except (tarfile.TarError, IOError, EOFError, zlib.error):
+            print 'error: the library %s is not a readable %s archive' % (lib.name, 'gzipped tar' if mode == 'r:gz' else 'tar')
+            sys.exit(2)
+        return contents
+
     def findMainClass(self, jarPath):
         signature = """public static com.google.gson.JsonObject main(com.google.gson.JsonObject);"""
         def run(cmd):
@@ -210,12 +735,16 @@ class Action(Item):
 
 
     def getActionExec(self, args, props, name):
+        action = self.getAction(args, props, name)
+        return action['exec'] if action is not None else None
+
+    # returns the named action or None if it does not exist
+    def getAction(self, args, props, name):
         res = self.httpGet(args, props, name)
         if res.status == httplib.OK:
-            execField = json.loads(res.read())['exec']
+            return json.loads(res.read())
         else:
-            execField = None
-        return execField
+            return None
 
     def csvToList(self, csv):
         return csv.split(',')
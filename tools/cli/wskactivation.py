@@ -14,8 +14,11 @@
 # limitations under the License.
 #
 
+import argparse
+import calendar
 import json
 import httplib
+import re
 import urllib
 import time
 from datetime import datetime, timedelta
@@ -33,6 +36,33 @@ SLACK_SECONDS = 5
 # the timestamp of the latest activation we have already reported
 lastTime = 0
 
+# the layouts of a time given to --since or --upto other than as milliseconds
+# since the epoch; each may be followed by fractional seconds and a UTC offset
+# (Z or +hh:mm) as in RFC 3339, and is local time without an offset
+TIME_LAYOUTS = [ '%Y-%m-%dT%H:%M:%S', '%Y-%m-%d %H:%M:%S', '%Y-%m-%dT%H:%M', '%Y-%m-%d %H:%M', '%Y-%m-%d' ]
+
+# parses a --since or --upto time into milliseconds since the epoch
+def timeValue(s):
+    if s.isdigit():
+        return long(s)
+    match = re.match(r'^(.+?)(\.\d+)?(Z|[+-]\d\d:\d\d)?$', s.strip())
+    for layout in TIME_LAYOUTS if match else []:
+        try:
+            t = datetime.strptime(match.group(1), layout)
+        except ValueError:
+            continue
+        seconds = float(match.group(2) or 0)
+        offset = match.group(3)
+        if offset is None:
+            seconds += time.mktime(t.timetuple())
+        else:
+            seconds += calendar.timegm(t.timetuple())
+            if offset != 'Z':
+                sign = -1 if offset[0] == '+' else 1
+                seconds += sign * (int(offset[1:3]) * 3600 + int(offset[4:6]) * 60)
+        return long(round(seconds * 1000))
+    raise argparse.ArgumentTypeError('cannot parse the time "%s"; give milliseconds since the epoch, a local time such as "2016-01-02 15:04" or an RFC 3339 time such as 2016-01-02T15:04:05Z' % s)
+
 #
 # 'wsk activations' CLI
 #
@@ -48,23 +78,30 @@ class Activation(Item):
         subcmd.add_argument('-s', '--skip', help='skip this many entities from the head of the collection', type=int, default=0)
         subcmd.add_argument('-l', '--limit', help='only return this many entities from the collection', type=int, default=30)
         subcmd.add_argument('-f', '--full', help='return full documents for each activation', action='store_true')
-        subcmd.add_argument('--upto', help='return activations with timestamps earlier than UPTO; measured in milliseconds since Thu, 01 Jan 1970 00:00:00',  type=long, default=0)
-        subcmd.add_argument('--since', help='return activations with timestamps later than SINCE; measured in milliseconds since Thu, 01 Jan 1970 00:00:00', type=long, default=0)
+        subcmd.add_argument('--upto', help='return activations with timestamps earlier than UPTO; measured in milliseconds since Thu, 01 Jan 1970 00:00:00, or a time such as "2016-01-02 15:04" or 2016-01-02T15:04:05Z',  type=timeValue, default=0)
+        subcmd.add_argument('--since', help='return activations with timestamps later than SINCE; measured in milliseconds since Thu, 01 Jan 1970 00:00:00, or a time such as "2016-01-02 15:04" or 2016-01-02T15:04:05Z', type=timeValue, default=0)
 
         subcmd = parser.add_parser('get', help='get %s' % self.name)
-        subcmd.add_argument('name', help='the name of the %s' % self.name)
+        subcmd.add_argument('name', nargs='?', help='the name of the %s' % self.name)
         subcmd.add_argument('project', nargs='?', help='project only this property')
         addAuthenticatedCommand(subcmd, props)
         subcmd.add_argument('-s', '--summary', help='summarize entity details', action='store_true')
+        view = subcmd.add_mutually_exclusive_group()
+        view.add_argument('--logs', help='also print the logs of the activation beneath it', action='store_true')
+        self.addRawArgument(view)
+        self.addLastArguments(subcmd)
 
         subcmd = parser.add_parser('logs', help='get the logs of an activation')
-        subcmd.add_argument('id', help='the activation id')
+        subcmd.add_argument('id', nargs='?', help='the activation id')
         addAuthenticatedCommand(subcmd, props)
         subcmd.add_argument('-s', '--strip', help='strip timestamp and stream information', action='store_true')
+        self.addLastArguments(subcmd)
 
         subcmd= parser.add_parser('result', help='get the result of an activation')
-        subcmd.add_argument('id', help='the invocation id')
+        subcmd.add_argument('id', nargs='?', help='the invocation id')
         addAuthenticatedCommand(subcmd, props)
+        self.addLastArguments(subcmd)
+        subcmd.add_argument('-q', '--quiet', help='print the result as compact JSON and exit non-zero if the activation failed', action='store_true')
 
         # poll
         subcmd= parser.add_parser('poll', help='poll continuously for log messages from currently running actions')
@@ -79,12 +116,16 @@ class Activation(Item):
     def cmd(self, args, props):
         if args.subcmd == 'list':
             return self.list(args, props)
-        elif args.subcmd == 'get':
-            return self.get(args, props)
-        elif args.subcmd == 'logs':
-            return self.logs(args, props)
-        elif args.subcmd == 'result':
-            return self.result(args, props)
+        elif args.subcmd in ['get', 'logs', 'result']:
+            code = self.resolveActivationId(args, props)
+            if code != 0:
+                return code
+            elif args.subcmd == 'get':
+                return self.get(args, props)
+            elif args.subcmd == 'logs':
+                return self.logs(args, props)
+            else:
+                return self.result(args, props)
         elif args.subcmd == 'poll':
             return self.poll(args, props)
         else:
@@ -95,14 +136,79 @@ class Activation(Item):
         """not allowed"""
         return 2
 
+    def addLastArguments(self, subcmd):
+        subcmd.add_argument('-l', '--last', help='use the most recent activation instead of an activation id', action='store_true')
+        subcmd.add_argument('--action', help='with --last, use the most recent activation of this action')
+
+    # sets the activation id for get, logs and result; with --last it is the
+    # id of the most recent activation. Returns 0 or an exit code on failure.
+    def resolveActivationId(self, args, props):
+        attr = 'name' if args.subcmd == 'get' else 'id'
+        if not args.last:
+            if getattr(args, attr) is None:
+                print 'error: an activation id is required unless --last is given'
+                return 2
+            return 0
+
+        if args.subcmd == 'get' and args.name is not None:
+            # with --last, the only positional argument is the projection
+            args.project = args.name
+
+        a = copy.deepcopy(args)
+        a.name = getQName(args.action, '_') if args.action else '/_'
+        a.full = False
+        a.skip = 0
+        a.limit = 1
+        a.upto = 0
+        a.since = 0
+        res = self.listCmd(a, props)
+        if res.status == httplib.OK:
+            result = json.loads(res.read())
+            if len(result) == 0:
+                print 'error: there are no activations%s' % (' for %s' % args.action if args.action else '')
+                return httplib.NOT_FOUND
+            setattr(args, attr, result[0]['activationId'])
+            return 0
+        else:
+            return responseError(res)
+
     def postProcess(self, entity):
         #entity['logs'] = json.loads(entity['logs'])
         return entity
 
     def get(self, args, props):
         args.name = getQName(args.name, '_') # kludge: use default namespace unless explicitly specified
+        if args.logs:
+            return self.getWithLogs(args, props)
         return Item.get(self, args, props)
 
+    # prints the activation, or its summary, and then its logs; the logs are
+    # taken from the activation record and fetched separately only if the
+    # record does not include them
+    def getWithLogs(self, args, props):
+        if args.project:
+            print 'error: --logs cannot be used with a projection'
+            return 2
+        res = self.httpGet(args, props)
+        if res.status != httplib.OK:
+            return responseError(res)
+        result = json.loads(res.read())
+        logs = result.pop('logs', None)
+        if logs is None:
+            res = self.logsCmd(args.name, args, props)
+            if res.status != httplib.OK:
+                return responseError(res)
+            logs = json.loads(res.read())['logs']
+        if args.summary:
+            print self.getEntitySummary(result)
+        else:
+            print 'ok: got %(item)s %(name)s' % {'item': self.name, 'name': args.name }
+            print getPrettyJson(result)
+        print bold('logs:')
+        if logs:
+            print '\n'.join(logs)
+        return 0
+
     def list(self, args, props):
         name = args.name if args.name else '/_'
         args.name = getQName(name, '_') # kludge: use default namespace unless explicitly specified
@@ -134,13 +240,17 @@ class Activation(Item):
         url = 'https://%(apibase)s/namespaces/%(namespace)s/activations/%(id)s/result' % {
            'apibase': apiBase(props),
            'namespace': urllib.quote(namespace),
-           'id': aid
+           'id': urllib.quote(aid, '')
         }
 
         res = request('GET', url, auth=args.auth, verbose=args.verbose)
 
         if res.status == httplib.OK:
             response = json.loads(res.read())
+            if args.quiet:
+                # bare JSON on one line for use in pipelines, e.g., $(wsk activation result ID -q)
+                print json.dumps(response.get('result', {}), sort_keys=True)
+                return 0 if response.get('success') else httplib.BAD_GATEWAY
             if 'result' in response:
                 result = response['result']
                 print getPrettyJson(result)
@@ -149,16 +259,7 @@ class Activation(Item):
             return responseError(res)
 
     def logs(self, args, props):
-        fqid = getQName(args.id, '_') # kludge: use default namespace unless explicitly specified
-        namespace, aid = parseQName(fqid, props)
-        url = 'https://%(apibase)s/namespaces/%(namespace)s/activations/%(id)s/logs' % {
-           'apibase': apiBase(props),
-           'namespace': urllib.quote(namespace),
-           'id': aid
-        }
-
-        res = request('GET', url, auth=args.auth, verbose=args.verbose)
-
+        res = self.logsCmd(args.id, args, props)
         if res.status == httplib.OK:
             result = json.loads(res.read())
             logs = result['logs']
@@ -179,6 +280,17 @@ class Activation(Item):
         except KeyboardInterrupt:
             print ''
 
+    # return the result of a 'wsk activation logs' call, an HTTPResponse
+    def logsCmd(self, id, args, props):
+        fqid = getQName(id, '_') # kludge: use default namespace unless explicitly specified
+        namespace, aid = parseQName(fqid, props)
+        url = 'https://%(apibase)s/namespaces/%(namespace)s/activations/%(id)s/logs' % {
+           'apibase': apiBase(props),
+           'namespace': urllib.quote(namespace),
+           'id': urllib.quote(aid, '')
+        }
+        return request('GET', url, auth=args.auth, verbose=args.verbose)
+
     # return the result of a 'wsk activation list' call, an HTTPResponse
     def listCmd(self, args, props):
         namespace, pname = parseQName(args.name, props)
@@ -14,7 +14,7 @@
 # limitations under the License.
 #
 
-from wskutil import addAuthenticatedCommand, apiBase, bold, request, responseError, parseQName, getQName, getPrettyJson, getParameterNamesFromAnnotations, getDescriptionFromAnnotations
+from wskutil import addAuthenticatedCommand, apiBase, bold, request, responseError, parseQName, getQName, getPrettyJson, getParameterNamesFromAnnotations, getDescriptionFromAnnotations, formatAnnotationValue, isValidEntityName
 import urllib
 import abc
 import json
@@ -50,6 +50,7 @@ class Item:
             subcmd.add_argument('project', nargs='?', help='project only this property')
             addAuthenticatedCommand(subcmd, props)
             subcmd.add_argument('-s', '--summary', help='summarize entity details', action='store_true')
+            self.addRawArgument(subcmd)
 
         if ('delete' in which):
             subcmd = subcmds.add_parser('delete', help='delete %s' % self.name)
@@ -62,6 +63,9 @@ class Item:
             addAuthenticatedCommand(subcmd, props)
             subcmd.add_argument('-s', '--skip', help='skip this many entities from the head of the collection', type=int, default=0)
             subcmd.add_argument('-l', '--limit', help='only return this many entities from the collection', type=int, default=30)
+            self.addFullArgument(subcmd)
+            self.addShowVersionArgument(subcmd)
+            self.addCountArgument(subcmd)
 
     def cmd(self, args, props):
         if args.subcmd == 'create':
@@ -96,8 +100,8 @@ class Item:
         annotations = entity['annotations']
         description = getDescriptionFromAnnotations(annotations)
         summary = '%s %s' % (bold(kind), fullName)
-        if description:
-            summary += ': %s' % (description)
+        if description not in ['', None]:
+            summary += ': %s' % formatAnnotationValue(description)
         if includeParams:
             parameterNames = getParameterNamesFromAnnotations(annotations)
             if parameterNames:
@@ -116,17 +120,28 @@ class Item:
     def postProcessGet(self, entity):
         return entity
 
+    # lines that "get" prints ahead of an entity to point out what is not
+    # plain from its JSON, override as needed
+    def getEntityNotes(self, entity):
+        return []
+
     # allows "delete" pre-processing, override as needed
     def preProcessDelete(self, args, props):
         return 0
 
     def put(self, args, props, update, payload):
         res = self.httpPut(args, props, update, payload)
-        return self.putResponse(res, update)
+        return self.putResponse(args, res, update)
 
     def get(self, args, props):
+        if args.raw and (args.summary or args.project):
+            print 'error: --raw cannot be used with a projection or --summary'
+            return 2
         res = self.httpGet(args, props)
-        if res.status == httplib.OK:
+        if res.status == httplib.OK and args.raw:
+            sys.stdout.write(res.read())
+            return 0
+        elif res.status == httplib.OK:
             result = self.postProcessGet(json.loads(res.read()))
             if args.summary:
                 summary = self.getEntitySummary(result)
@@ -141,6 +156,8 @@ class Item:
                     return 148
             else:
                 print 'ok: got %(item)s %(name)s' % {'item': self.name, 'name': args.name }
+                for note in self.getEntityNotes(result):
+                    print note
                 print getPrettyJson(result)
                 return 0
         else:
@@ -154,36 +171,77 @@ class Item:
         namespace, pname = parseQName(args.name, props)
         if pname:
             pname = ('/%s' % pname) if pname.endswith('/') else '/%s/' % pname
-        url = 'https://%(apibase)s/namespaces/%(namespace)s/%(collection)s%(package)s?skip=%(skip)s&limit=%(limit)s%(public)s' % {
+            pname = self.getSafeName(pname)
+        prefix = args.name_prefix if 'name_prefix' in args else None
+        url = 'https://%(apibase)s/namespaces/%(namespace)s/%(collection)s%(package)s?skip=%(skip)s&limit=%(limit)s%(public)s%(prefix)s' % {
             'apibase': apiBase(props),
             'namespace': urllib.quote(namespace),
             'collection': self.collection,
             'package': pname if pname else '',
             'skip': args.skip,
             'limit': args.limit,
-            'public': '&public=true' if 'shared' in args and args.shared else ''
+            'public': '&public=true' if 'shared' in args and args.shared else '',
+            'prefix': '&name=%s' % urllib.quote(prefix) if prefix else ''
         }
 
         res = request('GET', url, auth=args.auth, verbose=args.verbose)
 
         if res.status == httplib.OK:
             result = json.loads(res.read())
+            if 'shared' in args and args.shared:
+                # the API may list private entities too, so filter here as well
+                result = [ e for e in result if e['publish'] ]
+            if prefix:
+                # the API may ignore the name filter, so filter here as well
+                result = [ e for e in result if e['name'].startswith(prefix) ]
+            if 'full' in args and args.full:
+                res, result = self.getFullEntities(args, props, result)
+                if result is None:
+                    return responseError(res)
             print bold(self.collection)
-            for e in result:
-                print self.formatListEntity(e)
+            self.printList(args, result)
+            self.printCount(args, result)
             return 0
         else:
             return responseError(res)
 
+    # returns the failed response and None, or None and the full documents of
+    # the listed entities; a list holds only entity summaries, so each entity
+    # is fetched
+    def getFullEntities(self, args, props, entities):
+        docs = []
+        for e in entities:
+            res = self.httpGet(args, props, getQName(e['name'], e['namespace']))
+            if res.status != httplib.OK:
+                return res, None
+            docs.append(json.loads(res.read()))
+        return None, docs
+
+    # prints the entities of a list, override to arrange them differently
+    def printList(self, args, entities):
+        for e in entities:
+            if 'full' in args and args.full:
+                print getPrettyJson(e)
+            elif 'show_version' in args and args.show_version:
+                print '%s %s' % (self.formatListEntity(e), e.get('version', ''))
+            else:
+                print self.formatListEntity(e)
+
+    # prints how many entities a list has, after them, with --count
+    def printCount(self, args, entities):
+        if 'count' in args and args.count:
+            print '%(count)s %(items)s' % {'count': len(entities), 'items': self.name if len(entities) == 1 else self.collection }
+
     # returns the HTTP response for saving an item.
     def httpPut(self, args, props, update, payload):
         namespace, pname = parseQName(args.name, props)
+        self.validateName(pname)
         url = 'https://%(apibase)s/namespaces/%(namespace)s/%(collection)s/%(name)s%(update)s' % {
             'apibase': apiBase(props),
             'namespace': urllib.quote(namespace),
             'collection': self.collection,
             'name': self.getSafeName(pname),
-            'update': '?overwrite=true' if update else ''
+            'update': '?overwrite=true' if update or ('upsert' in args and args.upsert) else ''
         }
 
         headers= {
@@ -237,7 +295,7 @@ class Item:
             return responseError(res)
 
     # process put response and emit console message
-    def putResponse(self, res, update):
+    def putResponse(self, args, res, update):
         if res.status == httplib.OK:
             result = json.loads(res.read())
             print 'ok: %(mode)s %(item)s %(name)s' % {
@@ -246,14 +304,87 @@ class Item:
                   'name': result['name']
             }
             return 0
+        elif res.status == httplib.CONFLICT and not update:
+            code = responseError(res)
+            print 'error: %(item)s %(name)s already exists; change it with "wsk %(item)s update" or give --upsert to replace it' % {'item': self.name, 'name': args.name }
+            return code
         else:
             return responseError(res)
 
+    # exits with a usage error if the name is not allowed by the API, saving
+    # a round trip to the server.
+    def validateName(self, name):
+        if not isValidEntityName(name):
+            print 'error: %(item)s name "%(name)s" is not valid; names start with a letter, digit or underscore followed by letters, digits, underscores, spaces, @, . or - and may not end with a space' % {'item': self.name, 'name': name }
+            sys.exit(2)
+
+    # exits with a usage error if the name is qualified with a namespace other
+    # than the default namespace; when the default is "_" (the namespace of
+    # the auth key) there is nothing to compare with and any name is accepted
+    def checkNamespace(self, name, props):
+        namespace, _ = parseQName(name, props)
+        default = props['namespace']
+        if default != '_' and namespace != default:
+            print 'error: %(item)s %(name)s is in namespace %(namespace)s, not the default namespace %(default)s; omit --strict-namespace to confirm' % {'item': self.name, 'name': name, 'namespace': namespace, 'default': default }
+            sys.exit(2)
+
     # returns a name escaped so it can be used in a url.
     def getSafeName(self, name):
         safeChars = '@:./'
         return urllib.quote(name, safeChars)
 
+    # adds the --shared option which is either absent (leave as is), yes or no;
+    # --shared alone means yes, and the value is not case sensitive
+    def addSharedArgument(self, subcmd):
+        subcmd.add_argument('--shared', nargs='?', const='yes', type=str.lower, choices=['yes', 'no'], help='shared %s (default: private)' % self.name)
+
+    # adds the --upsert option which lets create replace an existing entity
+    # of the same name rather than fail because it already exists
+    def addUpsertArgument(self, subcmd):
+        subcmd.add_argument('--upsert', help='create the %s, or replace it if it already exists' % self.name, action='store_true')
+
+    # adds the --raw option which prints the response body as the server sent
+    # it, without reformatting it or reordering its keys
+    def addRawArgument(self, subcmd):
+        subcmd.add_argument('--raw', help='print the %s exactly as the server returns it' % self.name, action='store_true')
+
+    # adds the --full option which lists the full document of each entity
+    def addFullArgument(self, subcmd):
+        subcmd.add_argument('-f', '--full', help='return full documents for each %s' % self.name, action='store_true')
+
+    # adds the --show-version option which adds a version column to a list
+    def addShowVersionArgument(self, subcmd):
+        subcmd.add_argument('--show-version', help='show the version of each %s' % self.name, action='store_true')
+
+    # adds the --count option which ends a list with the number of entities
+    def addCountArgument(self, subcmd):
+        subcmd.add_argument('--count', help='end the list with the number of %s in it' % self.collection, action='store_true')
+
+    # adds the --strict-keys option which rejects a parameter or annotation
+    # given more than once, rather than keep the last value with a warning
+    def addStrictKeysArgument(self, subcmd):
+        subcmd.add_argument('--strict-keys', help='fail if a parameter or annotation is given more than once rather than use the last value', action='store_true')
+
+    # removes all but the last of the -p and -a values given for the same key,
+    # warning about each on stderr; with --strict-keys, reports them as errors
+    # instead and returns False
+    def removeDuplicateKeys(self, args):
+        ok = True
+        for kind, option in [ ('parameter', 'param'), ('annotation', 'annotation') ]:
+            values = getattr(args, option)
+            if not values:
+                continue
+            keys = [ v[0] for v in values ]
+            for key in sorted(set(k for k in keys if keys.count(k) > 1)):
+                if args.strict_keys:
+                    print 'error: %(kind)s %(key)s is given more than once' % {'kind': kind, 'key': key }
+                    ok = False
+                else:
+                    print >> sys.stderr, 'warning: %(kind)s %(key)s is given more than once; using the last value' % {'kind': kind, 'key': key }
+            last = dict([ (v[0], i) for i, v in enumerate(values) ])
+            setattr(args, option, [ v for i, v in enumerate(values) if last[v[0]] == i ])
+        return ok
+
     # adds publish parameter to payloads
     def addPublish(self, payload, args):
         if args.shared != None and not ('update' in args and args.update):
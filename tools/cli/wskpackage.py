@@ -19,7 +19,7 @@ import httplib
 import sys
 import urllib
 from wskitem import Item
-from wskutil import addAuthenticatedCommand, request, getParams, getAnnotations, responseError, parseQName, getQName, hilite, apiBase
+from wskutil import addAuthenticatedCommand, request, getParams, getAnnotations, responseError, parseQName, getQName, hilite, bold, apiBase, printPrettyJson
 
 #
 # 'wsk packages' CLI
@@ -33,16 +33,21 @@ class Package(Item):
         subcmd = parser.add_parser('create', help='create a new package')
         subcmd.add_argument('name', help='the name of the package')
         addAuthenticatedCommand(subcmd, props)
+        self.addUpsertArgument(subcmd)
         subcmd.add_argument('-a', '--annotation', help='annotations', nargs=2, action='append')
+        subcmd.add_argument('--annotation-file', help='file containing a JSON object of annotations; -a takes precedence', metavar='file')
         subcmd.add_argument('-p', '--param', help='default parameters', nargs=2, action='append')
-        subcmd.add_argument('--shared', nargs='?', const='yes', choices=['yes', 'no'], help='shared action (default: private)')
+        subcmd.add_argument('--param-file', help='file containing a JSON object of default parameters; -p takes precedence', metavar='file')
+        self.addSharedArgument(subcmd)
 
         subcmd = parser.add_parser('update', help='create a new package')
         subcmd.add_argument('name', help='the name of the package')
         addAuthenticatedCommand(subcmd, props)
         subcmd.add_argument('-a', '--annotation', help='annotations', nargs=2, action='append')
+        subcmd.add_argument('--annotation-file', help='file containing a JSON object of annotations; -a takes precedence', metavar='file')
         subcmd.add_argument('-p', '--param', help='default parameters', nargs=2, action='append')
-        subcmd.add_argument('--shared', nargs='?', const='yes', choices=['yes', 'no'], help='shared action (default: private)')
+        subcmd.add_argument('--param-file', help='file containing a JSON object of default parameters; -p takes precedence', metavar='file')
+        self.addSharedArgument(subcmd)
 
         subcmd = parser.add_parser('bind', help='bind parameters to the package')
         subcmd.add_argument('package', help='the name of the package')
@@ -51,9 +56,14 @@ class Package(Item):
         subcmd.add_argument('-a', '--annotation', help='annotations', nargs=2, action='append')
         subcmd.add_argument('-p', '--param', help='default parameters', nargs=2, action='append')
 
+        subcmd = parser.add_parser('unbind', help='delete a package binding')
+        subcmd.add_argument('name', help='the name of the package binding')
+        addAuthenticatedCommand(subcmd, props)
+
         subcmd = parser.add_parser('refresh', help='refresh package bindings')
         subcmd.add_argument('name', nargs='?', help='the namespace to refresh')
         addAuthenticatedCommand(subcmd, props)
+        subcmd.add_argument('--json', help='print the binding updates as JSON', action='store_true')
 
         self.addDefaultCommands(parser, props)
 
@@ -62,21 +72,45 @@ class Package(Item):
             return self.refresh(args, props)
         if args.subcmd == 'bind':
             return self.bind(args, props)
+        if args.subcmd == 'unbind':
+            return self.unbind(args, props)
         else:
             return super(Package, self).cmd(args, props)
 
     def create(self, args, props, update):
         payload = {}
-        if args.annotation:
+        if args.annotation or args.annotation_file:
             payload['annotations'] = getAnnotations(args)
-        if args.param:
+        if args.param or args.param_file:
             payload['parameters'] = getParams(args)
         if args.shared:
             self.addPublish(payload, args)
         return self.put(args, props, update, json.dumps(payload))
 
+    # points out the source of a binding so that it is clear which package
+    # the binding refers to
+    def getEntityNotes(self, entity):
+        source = self.getBindingSource(entity)
+        return [ 'binding -> %s' % source ] if source else []
+
+    def getEntitySummary(self, entity):
+        summary = super(Package, self).getEntitySummary(entity)
+        source = self.getBindingSource(entity)
+        if source:
+            summary += '\n   (%s -> %s)' % (bold('binding'), source)
+        return summary
+
+    # returns the fully qualified name of the package a binding refers to,
+    # or None if the package is not a binding
+    def getBindingSource(self, entity):
+        binding = entity.get('binding')
+        if binding and binding.get('name'):
+            return getQName(binding['name'], '/%s' % binding.get('namespace', '_'))
+        return None
+
     def bind(self, args, props):
         namespace, pname = parseQName(args.name, props)
+        self.validateName(pname)
         url = 'https://%(apibase)s/namespaces/%(namespace)s/packages/%(name)s' % {
             'apibase': apiBase(props),
             'namespace': urllib.quote(namespace),
@@ -104,6 +138,19 @@ class Package(Item):
         else:
             return responseError(res)
 
+    # deletes a package binding; refuses to delete a package that is not a
+    # binding so that the source of a binding is not deleted by accident
+    def unbind(self, args, props):
+        res = self.httpGet(args, props)
+        if res.status == httplib.OK:
+            result = json.loads(res.read())
+            if not result.get('binding'):
+                print 'error: package %(name)s is not a binding; use "wsk package delete" to delete it' % {'name': args.name }
+                return 2
+            return self.delete(args, props)
+        else:
+            return responseError(res)
+
     def refresh(self, args, props):
         namespace, _ = parseQName(args.name, props)
         url = 'https://%(apibase)s/namespaces/%(namespace)s/packages/refresh' % {
@@ -114,7 +161,10 @@ class Package(Item):
         res = request('POST', url, auth=args.auth, verbose=args.verbose)
         if res.status == httplib.OK:
             result = json.loads(res.read())
-            print '%(namespace)s refreshed successfully!' % {'namespace': args.name}
+            if args.json:
+                printPrettyJson(result)
+                return 0
+            print '%(namespace)s refreshed successfully!' % {'namespace': namespace}
             print hilite('created bindings:', True)
             print '\n'.join(result['added'])
             print hilite('updated bindings:', True)
@@ -123,11 +173,8 @@ class Package(Item):
             print '\n'.join(result['deleted'])
             return 0
         elif res.status == httplib.NOT_IMPLEMENTED:
-            print 'error: This feature is not implemented in the targeted deployment'
-            return responseError(res)
+            return responseError(res, 'error: This feature is not implemented in the targeted deployment:')
         else:
-            result = json.loads(res.read())
-            print 'error: %(error)s' % {'error': result['error']}
             return responseError(res)
 
 
@@ -26,6 +26,16 @@ import pkg_resources
 WHISK_VERSION_DATE='WHISK_VERSION_DATE'
 CLI_API_HOST = 'CLI_API_HOST'
 
+# environment variables which take precedence over the user property file
+ENVIRONMENT_OVERRIDES = {
+    'AUTH': 'WHISK_AUTH',
+    'APIHOST': 'WHISK_APIHOST',
+    'APIVERSION': 'WHISK_APIVERSION',
+    'NAMESPACE': 'WHISK_NAMESPACE',
+    'CERT': 'WHISK_CERT',
+    'KEY': 'WHISK_KEY'
+}
+
 def propfile(base):
     if base != '':
         filename = '%s/whisk.properties' % base
@@ -41,6 +51,31 @@ def importPropsIfAvailable(filename):
     thefile = open(filename, 'r') if os.path.isfile(filename) and os.path.exists(filename) else []
     return importProps(thefile)
 
+#
+# Returns a copy of props with values replaced by those set in the environment
+# (see ENVIRONMENT_OVERRIDES); command line flags are resolved later and take
+# precedence over both, giving: flag > environment > property file > default
+#
+def importEnvironmentOverrides(props):
+    props = props.copy()
+    for key, variable in ENVIRONMENT_OVERRIDES.items():
+        value = os.environ.get(variable)
+        if value is not None and value.strip() != '':
+            props[key] = value.strip()
+    return props
+
+#
+# Returns the authorization key on the first line of filename, or None if the
+# file cannot be read or the line is empty
+#
+def importAuthFile(filename):
+    try:
+        with open(filename, 'r') as f:
+            auth = f.readline().strip()
+    except IOError:
+        return None
+    return auth if auth != '' else None
+
 def importDefaultProps():
     packagename = 'whisk'
     filename = 'default.props'
@@ -53,6 +88,19 @@ def importDefaultProps():
             theFile = None
     return importProps(theFile) if theFile is not None else None
 
+#
+# Returns the CLI version: the version date in default.props if there is one,
+# else the version of the installed openwhisk package if the CLI was installed
+# with pip, else None
+#
+def getCliVersion(whiskprops):
+    if whiskprops.get('WHISK_VERSION_DATE'):
+        return whiskprops['WHISK_VERSION_DATE']
+    try:
+        return pkg_resources.get_distribution('openwhisk').version
+    except pkg_resources.DistributionNotFound:
+        return None
+
 def importProps(stream):
     props = {}
     for line in stream:
@@ -72,8 +120,16 @@ def updateProps(key, value, filename):
     userProps[key] = value
     writeProps(userProps, filename)
 
+# creates the property file, and any missing parent directories, on first write
 def writeProps(props, filename):
+    created = not os.path.exists(filename)
+    directory = os.path.dirname(os.path.abspath(filename))
+    if not os.path.isdir(directory):
+        os.makedirs(directory, 0700)
     fileHandle = open(filename, 'w')
+    if created:
+        os.chmod(filename, 0600)
+        print 'ok: created property file %s' % os.path.abspath(filename)
     for key in props:
         line = key.upper() + '=' + props[key]
         fileHandle.write(line + '\n')
@@ -17,9 +17,13 @@
 import json
 import httplib
 from wskitem import Item
-from wskutil import addAuthenticatedCommand, apiBase, parseQName, request, responseError
+from wskutil import addAuthenticatedCommand, apiBase, bold, getQName, parseQName, request, responseError
 import urllib
 
+# the number of rules to list in each request when all the rules in a
+# namespace are needed
+RULES_PAGE_SIZE = 100
+
 class Rule(Item):
 
     def __init__(self):
@@ -31,7 +35,7 @@ class Rule(Item):
         subcmd.add_argument('trigger', help='the trigger')
         subcmd.add_argument('action', help='the action')
         addAuthenticatedCommand(subcmd, props)
-        subcmd.add_argument('--shared', nargs='?', const='yes', choices=['yes', 'no'], help='shared action (default: private)')
+        self.addSharedArgument(subcmd)
         subcmd.add_argument('--enable', help='enable rule after creating it', action='store_true', default=False)
 
         subcmd = parser.add_parser('delete', help='delete %s' % self.name)
@@ -44,7 +48,7 @@ class Rule(Item):
         subcmd.add_argument('trigger', help='the trigger')
         subcmd.add_argument('action', help='the action')
         addAuthenticatedCommand(subcmd, props)
-        subcmd.add_argument('--shared', nargs='?', const='yes', choices=['yes', 'no'], help='shared action (default: private)')
+        self.addSharedArgument(subcmd)
 
         subcmd = parser.add_parser('enable', help='enable rule')
         subcmd.add_argument('name', help='the name of the rule')
@@ -58,7 +62,17 @@ class Rule(Item):
         subcmd.add_argument('name', help='the name of the rule')
         addAuthenticatedCommand(subcmd, props)
 
-        self.addDefaultCommands(parser, props, ['get', 'list'])
+        subcmd = parser.add_parser('list', help='list all %s' % self.collection)
+        subcmd.add_argument('name', nargs='?', help='the namespace to list')
+        addAuthenticatedCommand(subcmd, props)
+        subcmd.add_argument('-s', '--skip', help='skip this many entities from the head of the collection', type=int, default=0)
+        subcmd.add_argument('-l', '--limit', help='only return this many entities from the collection', type=int, default=30)
+        subcmd.add_argument('--trigger', help='list only rules for this trigger')
+        subcmd.add_argument('--action', help='list only rules for this action')
+        self.addFullArgument(subcmd)
+        self.addCountArgument(subcmd)
+
+        self.addDefaultCommands(parser, props, ['get'])
 
     def cmd(self, args, props):
         if args.subcmd == 'enable':
@@ -76,9 +90,89 @@ class Rule(Item):
             self.addPublish(payload, args)
         code = self.put(args, props, update, json.dumps(payload))
         if (code == 0 and 'enable' in args and args.enable):
-            return self.setState(args, props, True)
-        else:
-            return code
+            code = self.setState(args, props, True)
+            if code != 0:
+                # the rule is left in place so that enabling it can be retried
+                print 'error: rule %(name)s was created but is not enabled; enable it with "wsk rule enable %(name)s"' % {'name': args.name }
+        return code
+
+    # lists rules, keeping only those for the given trigger and/or action
+    def list(self, args, props):
+        if not args.trigger and not args.action:
+            return super(Rule, self).list(args, props)
+
+        namespace, _ = parseQName(args.name, props)
+        trigger = parseQName(args.trigger, props)[1] if args.trigger else None
+        action = parseQName(args.action, props)[1] if args.action else None
+        res, rules = self.getRules(args, props, namespace, args.skip, args.limit)
+        if rules is None:
+            return responseError(res)
+
+        rules = [ r for r in rules if (trigger is None or r['trigger'] == trigger) and (action is None or r['action'] == action) ]
+        print bold(self.collection)
+        self.printList(args, rules)
+        self.printCount(args, rules)
+        return 0
+
+    # returns the failed response and None, or None and the rules in the
+    # namespace; the rule summaries in a list do not name the trigger, action
+    # or status, so each rule is fetched
+    def getRules(self, args, props, namespace, skip = 0, limit = 0):
+        res, summaries = self.getRuleSummaries(args, props, namespace, skip, limit)
+        if summaries is None:
+            return res, None
+        return self.fetchRules(args, props, summaries)
+
+    # returns the failed response and None, or None and all the rules in the
+    # namespace, listed a page at a time until a page has no new rule so that
+    # a host which caps the size of a list does not leave any out (and one
+    # which ignores skip does not page forever); as with getRules, each rule
+    # is also fetched, so this costs a request per rule
+    def getAllRules(self, args, props, namespace):
+        summaries = []
+        while True:
+            res, page = self.getRuleSummaries(args, props, namespace, len(summaries), RULES_PAGE_SIZE)
+            if page is None:
+                return res, None
+            seen = [ (e['namespace'], e['name']) for e in summaries ]
+            page = [ e for e in page if (e['namespace'], e['name']) not in seen ]
+            if not page:
+                return self.fetchRules(args, props, summaries)
+            summaries += page
+
+    # returns the failed response and None, or None and a page of the rule
+    # summaries in the namespace
+    def getRuleSummaries(self, args, props, namespace, skip, limit):
+        url = 'https://%(apibase)s/namespaces/%(namespace)s/rules?skip=%(skip)s&limit=%(limit)s' % {
+            'apibase': apiBase(props),
+            'namespace': urllib.quote(namespace),
+            'skip': skip,
+            'limit': limit
+        }
+
+        res = request('GET', url, auth=args.auth, verbose=args.verbose)
+        if res.status != httplib.OK:
+            return res, None
+        return None, json.loads(res.read())
+
+    # returns the failed response and None, or None and the rules with the
+    # given summaries
+    def fetchRules(self, args, props, summaries):
+        rules = []
+        for e in summaries:
+            res = self.httpGet(args, props, getQName(e['name'], e['namespace']))
+            if res.status != httplib.OK:
+                return res, None
+            rules.append(json.loads(res.read()))
+        return None, rules
+
+    # summarizes a rule with the trigger and action it connects and whether
+    # it is active, i.e., whether the trigger fires the action
+    def getEntitySummary(self, entity):
+        summary = super(Rule, self).getEntitySummary(entity)
+        summary += '\n   (%s: %s)' % (bold('status'), entity['status'])
+        summary += '\n   (%s: %s -> %s)' % (bold('fires'), entity['trigger'], entity['action'])
+        return summary
 
     def preProcessDelete(self, args, props):
         if (args.disable):
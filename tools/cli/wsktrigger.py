@@ -16,9 +16,12 @@
 
 import json
 import httplib
+import sys
+import time
 from wskitem import Item
 from wskaction import Action
-from wskutil import addAuthenticatedCommand, apiBase, dict2obj, getParam, getParams, getActivationArgument, getAnnotations, parseQName, responseError, request, getQName
+from wskrule import Rule
+from wskutil import addAuthenticatedCommand, apiBase, dict2obj, getParam, getParams, getActivationArgument, getAnnotations, parseQName, responseError, request, getQName, mergeKeyValues
 import urllib
 
 class Trigger(Item):
@@ -30,7 +33,8 @@ class Trigger(Item):
         subcmd = parser.add_parser('create', help='create new trigger')
         subcmd.add_argument('name', help='the name of the trigger')
         addAuthenticatedCommand(subcmd, props)
-        subcmd.add_argument('--shared', nargs='?', const='yes', choices=['yes', 'no'], help='shared action (default: private)')
+        self.addUpsertArgument(subcmd)
+        self.addSharedArgument(subcmd)
         subcmd.add_argument('-a', '--annotation', help='annotations', nargs=2, action='append')
         subcmd.add_argument('-p', '--param', help='default parameters', nargs=2, action='append')
         subcmd.add_argument('-f', '--feed', help='trigger feed')
@@ -38,15 +42,19 @@ class Trigger(Item):
         subcmd = parser.add_parser('update', help='update an existing trigger')
         subcmd.add_argument('name', help='the name of the trigger')
         addAuthenticatedCommand(subcmd, props)
-        subcmd.add_argument('--shared', nargs='?', const='yes', choices=['yes', 'no'], help='shared action (default: private)')
+        self.addSharedArgument(subcmd)
         subcmd.add_argument('-a', '--annotation', help='annotations', nargs=2, action='append')
         subcmd.add_argument('-p', '--param', help='default parameters', nargs=2, action='append')
+        subcmd.add_argument('--merge', help='add the parameters and annotations to those of the trigger rather than replace them', action='store_true')
 
         subcmd = parser.add_parser('fire', help='fire trigger event')
         subcmd.add_argument('name', help='the name of the trigger')
         subcmd.add_argument('payload', help='the payload to attach to the trigger', nargs ='?')
         addAuthenticatedCommand(subcmd, props)
         subcmd.add_argument('-p', '--param', help='parameters', nargs=2, action='append')
+        subcmd.add_argument('--require-rule', help='fail rather than fire the trigger if no active rule connects it to an action', action='store_true')
+        subcmd.add_argument('--repeat', help='fire the trigger this many times, one after the other', type=int, metavar='N')
+        subcmd.add_argument('--interval', help='with --repeat, wait this many milliseconds between fires', type=int, default=0, metavar='MS')
 
         self.addDefaultCommands(parser, props)
 
@@ -62,11 +70,21 @@ class Trigger(Item):
         createFeed  = 'feed' in args and args.feed
 
         if createFeed:
-            annotations.append(getParam('feed', args.feed))
+            # record the fully qualified feed so that delete can find it
+            annotations.append(getParam('feed', getQName(args.feed, props['namespace'])))
             # if creating a trigger feed, parameters are passed to
             # the feed action, not the trigger
             parameters = []
 
+        if update and args.merge:
+            # the stored values are kept unless given again on the command line
+            res = self.httpGet(args, props)
+            if res.status != httplib.OK:
+                return responseError(res)
+            trigger = json.loads(res.read())
+            annotations = mergeKeyValues(trigger.get('annotations', []), annotations)
+            parameters = mergeKeyValues(trigger.get('parameters', []), parameters)
+
         payload = {}
         if annotations:
             payload['annotations'] = annotations
@@ -78,16 +96,50 @@ class Trigger(Item):
         if putResponse.status == httplib.OK and createFeed:
             return self.createFeed(args, props, putResponse)
         else:
-            return self.putResponse(putResponse, update)
+            return self.putResponse(args, putResponse, update)
 
     def fire(self, args, props):
+        if args.repeat is not None and args.repeat < 1:
+            print 'error: --repeat must be at least 1'
+            return 2
+        if args.interval < 0:
+            print 'error: --interval must not be negative'
+            return 2
+        elif args.interval > 0 and args.repeat is None:
+            print >> sys.stderr, 'warning: --interval has no effect without --repeat'
         namespace, pname = parseQName(args.name, props)
+        if args.require_rule:
+            res, rules = Rule().getAllRules(args, props, namespace)
+            if rules is None:
+                return responseError(res)
+            if not [ r for r in rules if r['trigger'] == pname and r['status'] == 'active' ]:
+                print 'error: trigger %(name)s has no active rule, so firing it would not run any action' % {'name': args.name }
+                return 2
         url = 'https://%(apibase)s/namespaces/%(namespace)s/triggers/%(name)s' % {
             'apibase': apiBase(props),
             'namespace': urllib.quote(namespace),
             'name': self.getSafeName(pname)
         }
         payload = json.dumps(getActivationArgument(args))
+        if args.repeat is None:
+            return self.fireOnce(args, url, payload)
+
+        failures = []
+        for i in range(args.repeat):
+            if i > 0 and args.interval > 0:
+                time.sleep(args.interval / 1000.0)
+            code = self.fireOnce(args, url, payload)
+            if code != 0:
+                failures.append(code)
+        if failures:
+            print 'error: %(failed)s of %(total)s fires of %(name)s failed' % {'failed': len(failures), 'total': args.repeat, 'name': args.name }
+            return failures[0]
+        else:
+            print 'ok: fired %(name)s %(total)s times' % {'name': args.name, 'total': args.repeat }
+            return 0
+
+    # posts one trigger event and reports its activation id
+    def fireOnce(self, args, url, payload):
         headers= {
             'Content-Type': 'application/json'
         }
@@ -130,6 +182,7 @@ class Trigger(Item):
         feedResponse = Action().doInvoke(dict2obj(feedArgs), props)
         if feedResponse.status == httplib.OK:
             print 'ok: created %s feed %s' % (self.name, args.name)
+            return 0
         else:
             print 'error: failed to create %s feed %s' % (self.name, args.name)
             # clean up by deleting trigger
@@ -164,3 +217,5 @@ class Trigger(Item):
             else:
                 print 'error: failed to delete %s feed %s but did delete the trigger' % (self.name, args.name)
                 return responseError(feedResponse, None)
+        else:
+            return self.deleteResponse(args, res)
@@ -21,8 +21,78 @@ import httplib
 import ssl
 import base64
 import collections
+import re
+import select
+import socket
+import threading
 from urlparse import urlparse
 
+# the (certificate, key) file pair presented to the API host for mutual TLS, if any
+clientCertificate = None
+
+def setClientCertificate(cert, key):
+    global clientCertificate
+    clientCertificate = (cert, key)
+
+# whether connections are kept open and reused for later requests to the same
+# host, which saves a connection and TLS handshake per request in bulk commands;
+# connections are kept per thread since httplib connections are not thread safe
+keepAlive = True
+connections = threading.local()
+
+def setKeepAlive(enabled):
+    global keepAlive
+    keepAlive = enabled
+
+# the methods whose requests may be sent again when a reused connection fails
+# after sending, since the host gets the same outcome if it did receive them;
+# an invoke or trigger fire (POST) would run twice
+IDEMPOTENT_METHODS = [ 'GET', 'HEAD', 'PUT', 'DELETE' ]
+
+# the largest response body in bytes that is read, so that a misbehaving
+# host cannot exhaust memory with an endless response
+MAX_RESPONSE_BYTES = 50 * 1024 * 1024
+maxResponseBytes = MAX_RESPONSE_BYTES
+
+def setMaxResponseBytes(limit):
+    global maxResponseBytes
+    maxResponseBytes = limit
+
+# returns a connection to the host of the url, and whether it was reused
+def getConnection(url, timeout = None):
+    key = (url.scheme, url.netloc)
+    cache = connections.__dict__.setdefault('cache', {})
+    if timeout is not None:
+        # a connection with a timeout is not kept for requests without one
+        return newConnection(url, timeout), False
+    if keepAlive and key in cache:
+        return cache[key], True
+    conn = newConnection(url, socket._GLOBAL_DEFAULT_TIMEOUT)
+    if keepAlive:
+        cache[key] = conn
+    return conn, False
+
+def newConnection(url, timeout):
+    if url.scheme == 'http':
+        return httplib.HTTPConnection(url.netloc, timeout=timeout)
+    certs = {}
+    if clientCertificate is not None:
+        certs = { 'cert_file': clientCertificate[0], 'key_file': clientCertificate[1] }
+    if hasattr(ssl, '_create_unverified_context'):
+        return httplib.HTTPSConnection(url.netloc, timeout=timeout, context=ssl._create_unverified_context(), **certs)
+    else:
+        return httplib.HTTPSConnection(url.netloc, timeout=timeout, **certs)
+
+# returns true if the host has closed an idle connection (or sent something
+# unasked on it), which shows as the connection being readable
+def isClosedByHost(conn):
+    return conn.sock is not None and select.select([ conn.sock ], [], [], 0)[0] != []
+
+def closeConnection(url):
+    conn = connections.__dict__.get('cache', {}).pop((url.scheme, url.netloc), None)
+    if conn is not None:
+        conn.close()
+
 def supportsColor():
     if (sys.platform != 'win32' or 'ANSICON' in os.environ) and sys.stdout.isatty():
         return True
@@ -49,16 +119,21 @@ def addAuthenticatedCommand(subcmd, props):
     auth = props.get('AUTH')
     required = True if auth is None else False
     subcmd.add_argument('-u', '--auth', help='authorization key', default=auth, required=required)
+    # to report a missing key as argparse would when it is known to be missing
+    subcmd.set_defaults(authParser=subcmd)
 
-def request(method, urlString, body = '', headers = {}, auth = None, verbose = False):
+# sends a request; when verbose, the request and response are printed, with
+# loggedBody shown in place of the body if given (e.g., to hide secrets).
+# A request with a timeout in seconds fails if the host does not respond in
+# time; otherwise it waits as long as the host takes.
+def request(method, urlString, body = '', headers = {}, auth = None, verbose = False, loggedBody = None, timeout = None):
     url = urlparse(urlString)
-    if url.scheme == 'http':
-        conn = httplib.HTTPConnection(url.netloc)
-    else:
-        if hasattr(ssl, '_create_unverified_context'):
-            conn = httplib.HTTPSConnection(url.netloc, context=ssl._create_unverified_context())
-        else:
-            conn = httplib.HTTPSConnection(url.netloc)
+    conn, reused = getConnection(url, timeout)
+    if reused and method not in IDEMPOTENT_METHODS and isClosedByHost(conn):
+        # a request that cannot be sent again is not risked on a connection
+        # the host is known to have closed
+        closeConnection(url)
+        conn, reused = getConnection(url, timeout)
 
     if auth != None:
         auth = base64.encodestring(auth).replace('\n', '')
@@ -72,20 +147,43 @@ def request(method, urlString, body = '', headers = {}, auth = None, verbose = F
         print getPrettyJson(headers)
         if body != '':
             print 'Body sent:'
-            print body
+            print body if loggedBody is None else loggedBody
 
     try:
-        conn.request(method, urlString, body, headers)
-        res = conn.getresponse()
+        sent = False
+        try:
+            conn.request(method, urlString, body, headers)
+            sent = True
+            res = conn.getresponse()
+        except (httplib.BadStatusLine, httplib.CannotSendRequest, socket.error):
+            if not reused or (sent and method not in IDEMPOTENT_METHODS):
+                raise
+            # the host closed the connection while it was idle, so reconnect
+            closeConnection(url)
+            conn, reused = getConnection(url, timeout)
+            conn.request(method, urlString, body, headers)
+            res = conn.getresponse()
         body = ''
         try:
-            body = res.read()
+            # reads until the response ends, which finishes a chunked response
+            # so that the connection can be reused, or is over the limit
+            while len(body) <= maxResponseBytes:
+                chunk = res.read(maxResponseBytes + 1 - len(body))
+                if not chunk:
+                    break
+                body += chunk
         except httplib.IncompleteRead as e:
-            body = e.partial
+            body += e.partial
+            closeConnection(url)
+        if len(body) > maxResponseBytes:
+            # the rest of the response is not read, so the connection cannot be reused
+            raise IOError('the response is larger than %s bytes; use --max-response to accept a larger one' % maxResponseBytes)
 
         # patch the read to return just the body since the normal read
         # can only be done once
         res.read = lambda: body
+        if res.will_close:
+            closeConnection(url)
 
         if verbose:
             print '--------'
@@ -96,6 +194,7 @@ def request(method, urlString, body = '', headers = {}, auth = None, verbose = F
             print '========'
         return res
     except Exception, e:
+        closeConnection(url)
         res = dict2obj({ 'status' : 500, 'error': str(e) })
         return res
 
@@ -113,7 +212,10 @@ def responseError(res, prefix = 'error:'):
         else:
             print getPrettyJson(result)
     except:
-        if res.status == 502:
+        if response:
+            # e.g., an HTML error page from a proxy in front of the API host
+            print getResponseSnippet(res, response)
+        elif res.status == 502:
             print 'connection failed or timed out'
         elif isinstance(res, collections.Iterable):
             if 'read' in res:
@@ -126,30 +228,68 @@ def responseError(res, prefix = 'error:'):
             print response
         else:
             print 'unrecognized failure'
+    if res.status == httplib.UNAUTHORIZED:
+        print 'error: authentication failed; check the authorization key given with --auth or set with "wsk property set --auth"'
+    elif res.status == httplib.FORBIDDEN:
+        print 'error: not authorized; check that the authorization key is entitled to the namespace'
     return res.status
 
-# creates [ { key: "key name", value: "the value" }* ] from annotations.
+# the most characters of a response that is not JSON to show in an error
+RESPONSE_SNIPPET_LENGTH = 200
+
+# returns a readable excerpt of a response body that is not JSON, with any
+# markup removed, so that an error does not show as a JSON parse failure
+def getResponseSnippet(res, body):
+    contentType = res.getheader('content-type', 'unknown content type') if hasattr(res, 'getheader') else 'unknown content type'
+    text = ' '.join(re.sub(r'<[^>]*>', ' ', body).split())
+    if len(text) > RESPONSE_SNIPPET_LENGTH:
+        text = text[:RESPONSE_SNIPPET_LENGTH] + '...'
+    return 'the server returned a non-JSON response (HTTP %s, %s): %s' % (res.status, contentType, text)
+
+# creates [ { key: "key name", value: "the value" }* ] from annotations;
+# annotations given with -a take precedence over those in an annotation file.
 def getAnnotations(args):
     annotations = []
     if args.annotation:
         for annotation in args.annotation:
             annotations.append(getParam(annotation[0], annotation[1]))
+    if 'annotation_file' in args and args.annotation_file:
+        annotations = mergeKeyValues(getKeyValuesFromFile(args.annotation_file), annotations)
     return annotations
 
+# returns the JSON value in a file, or exits with an error naming the file and,
+# for a file that is not valid JSON, where parsing failed
+def readJsonFile(filename):
+    try:
+        with open(filename) as f:
+            return json.load(f)
+    except IOError as e:
+        print 'error: cannot read file %s: %s.' % (filename, e.strerror)
+        sys.exit(2)
+    except ValueError as e:
+        print 'error: file %s is not valid JSON: %s.' % (filename, e)
+        sys.exit(2)
+
+# reads a JSON object from a file and creates [ { key: "key name", value: "the value" }* ]
+# from its fields, keeping values as they are; exits with a usage error if the
+# file cannot be read or does not hold a JSON object.
+def getKeyValuesFromFile(filename):
+    obj = readJsonFile(filename)
+    if not isinstance(obj, dict):
+        print 'error: file %s must contain a JSON object.' % filename
+        sys.exit(2)
+    return [ { 'key': key, 'value': obj[key] } for key in obj ]
+
 # creates [ { key: "key name", value: "the value" }* ] from arguments
-# to conform to Action schema for parameters and annotations
+# to conform to Action schema for parameters and annotations; parameters
+# given with -p take precedence over those in a parameter file.
 def getParams(args):
     params = []
     if args.param:
         for param in args.param:
             params.append(getParam(param[0], param[1]))
-    if 'payload' in args and args.payload:
-        try:
-            obj = json.loads(args.payload)
-            for key in obj:
-                params.append(getParam(key, obj[key]))
-        except:
-            params.append(getParam('payload', args.payload))
+    if 'param_file' in args and args.param_file:
+        params = mergeKeyValues(getKeyValuesFromFile(args.param_file), params)
     return params
 
 # creates a parameter { key: "key name", value: "the value" }
@@ -162,6 +302,12 @@ def getParam(key, value):
         p['value'] = value
     return p
 
+# merges two [ { key: "key name", value: "the value" }* ] lists; entries
+# in overrides replace entries in base with the same key
+def mergeKeyValues(base, overrides):
+    keys = [ o['key'] for o in overrides ]
+    return [ b for b in base if b['key'] not in keys ] + overrides
+
 # creates JSON object from parameters; if payload exists, and it is
 # not a valid JSON object, merge its fields else create payload
 # property with args.payload as the value
@@ -174,14 +320,44 @@ def getActivationArgument(args):
             except:
                 params[p[0]]= p[1]
     if 'payload' in args and args.payload:
-        try:
-            obj = json.loads(args.payload)
-            for key in obj:
-                params[key] = obj[key]
-        except:
-            params['payload'] = args.payload
+        params.update(getPayloadArgument(args.payload))
     return params
 
+# returns the fields of a payload given as a JSON object, or the payload as
+# the value of a "payload" field if it is not one (a JSON scalar keeps its type,
+# anything else is passed as text); exits with a usage error for a JSON array,
+# which cannot be passed as a value without losing its structure
+def getPayloadArgument(payload):
+    try:
+        obj = json.loads(payload)
+    except ValueError:
+        obj = None
+    if isinstance(obj, dict):
+        return obj
+    elif isinstance(obj, list):
+        print 'error: the payload is a JSON array; it must be a JSON object, e.g., {"payload": %s}' % payload
+        sys.exit(2)
+    elif obj is not None:
+        return { 'payload': obj }
+    else:
+        return { 'payload': payload }
+
+# returns a copy of the object with the values of keys which look like they
+# hold secrets (token, password or secret) masked, for display purposes
+def redactSecrets(obj):
+    if isinstance(obj, dict):
+        redacted = {}
+        for key, value in obj.items():
+            if any(s in key.lower() for s in ['token', 'password', 'secret']):
+                redacted[key] = '********'
+            else:
+                redacted[key] = redactSecrets(value)
+        return redacted
+    elif isinstance(obj, list):
+        return [ redactSecrets(o) for o in obj ]
+    else:
+        return obj
+
 def chooseFromArray(array):
     count = 1
     for value in array:
@@ -221,9 +397,39 @@ class dict2obj(dict):
         else:
             raise AttributeError('object has no attribute "%s"' % name)
 
+# whether lists of { key, value } pairs, i.e., parameters and annotations, are
+# printed sorted by key; object fields are always printed sorted
+sortKeyValues = False
+
+def setSortKeyValues(enabled):
+    global sortKeyValues
+    sortKeyValues = enabled
+
+# returns obj with every list of { key, value } pairs in it sorted by key
+def sortKeyValueLists(obj):
+    if isinstance(obj, dict):
+        return dict([ (k, sortKeyValueLists(v)) for k, v in obj.items() ])
+    elif isinstance(obj, list):
+        items = [ sortKeyValueLists(v) for v in obj ]
+        if items and all(isinstance(i, dict) and set(i.keys()) == set(['key', 'value']) for i in items):
+            items = sorted(items, key=lambda i: i['key'])
+        return items
+    else:
+        return obj
+
 def getPrettyJson(obj):
+    if sortKeyValues:
+        obj = sortKeyValueLists(obj)
     return json.dumps(obj, sort_keys=True, indent=4, separators=(',', ': '))
 
+# writes obj as pretty JSON to out as it is encoded, rather than building the
+# whole string first, so that large results do not need twice the memory
+def printPrettyJson(obj, out = sys.stdout):
+    if sortKeyValues:
+        obj = sortKeyValueLists(obj)
+    json.dump(obj, out, sort_keys=True, indent=4, separators=(',', ': '))
+    out.write('\n')
+
 # Return description string from annotations.
 def getDescriptionFromAnnotations(annotations):
     description = ''
@@ -232,6 +438,14 @@ def getDescriptionFromAnnotations(annotations):
             description = a['value']
     return description
 
+# renders an annotation value for a summary: a string as it is, any other
+# value (a number, boolean, array or object) as compact JSON, e.g., true
+# rather than Python's True
+def formatAnnotationValue(value):
+    if isinstance(value, basestring):
+        return value
+    return json.dumps(value, separators=(',', ':'), sort_keys=True)
+
 # Return list of parameters names from annotations.
 def getParameterNamesFromAnnotations(annotations):
     names = []
@@ -252,6 +466,17 @@ def resolveNamespace(props, key = 'namespace'):
 def getPathDelimiter():
     return '/'
 
+#
+# Allowed entity name (or package qualified name part) format, mirroring the
+# controller: the first character is a letter, digit or underscore, followed by
+# letters, digits, underscores, spaces, @, . or -. The name may not end with
+# a space.
+#
+ENTITY_NAME_REGEX = re.compile(r'\A([\w]|[\w][\w@ .-]*[\w@.-]+)\Z')
+
+def isValidEntityName(name):
+    return name is not None and all(ENTITY_NAME_REGEX.match(part) for part in name.split(getPathDelimiter()))
+
 #
 # Parse a (possibly fully qualified) resource name into
 # namespace and name components. If the given qualified
@@ -301,7 +526,24 @@ def getQName(qname, namespace = None):
         namespace = namespace if namespace else resolveNamespace({})
         return '%s%s%s%s' % (delimiter, namespace, delimiter, qname)
 
+# reduces an API host given as a bare host, a host and port, or an https url
+# (possibly with a path such as /api/v1 or a trailing slash) to host[:port];
+# raises ValueError for a url that is not https since requests are always https
+def normalizeApiHost(host):
+    if host is None:
+        return None
+    host = host.strip()
+    if '://' in host:
+        url = urlparse(host)
+        if url.scheme != 'https' or not url.netloc:
+            raise ValueError('the API host %s must be a host name or an https url' % host)
+        return url.netloc
+    else:
+        return host.split('/')[0]
+
+# returns host[:port]/api/version without a trailing slash, so that routes
+# joined to it with a single slash never contain an empty path segment
 def apiBase(props):
-    host = props['apihost']
-    version = props['apiversion']
+    host = props['apihost'].rstrip('/')
+    version = props['apiversion'].strip('/')
     return '%s/api/%s' % (host, version)